@@ -2,6 +2,10 @@ package main
 
 import (
 	_ "embed"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
 
 	"github.com/deosjr/elephanttalk/talk"
 )
@@ -9,9 +13,83 @@ import (
 //go:embed test.lisp
 var testpage string
 
+var (
+	device = flag.Int("device", 0, "index of the capture device to read frames from")
+	video  = flag.String("video", "", "read frames from a video file instead of a capture device")
+	frames = flag.String("frames", "", "read frames from a directory of png images instead of a capture device")
+	output = flag.String("output", "", "run headless: write debug and projector frames as png sequences to this directory; needs -stage-frames")
+	chess  = flag.Bool("chessboard", false, "regenerate calibration.json from chessboard views, even if it exists")
+	recal  = flag.Bool("recalibrate", false, "ignore saved calibration results and calibrate again")
+	homog  = flag.Bool("homography", false, "calibrate camera to projector mapping automatically by projecting a pattern")
+	cmask  = flag.Bool("colormask", false, "only detect circles close in colour to the calibrated dot colours")
+	stage  = flag.Int("stage-frames", 0, "advance calibration and stop the vision loop after this many frames instead of on keypress; needs -output")
+)
+
 func main() {
+	flag.Parse()
+	if *stage > 0 && *output == "" {
+		// scripted keys never pump HighGUI events, so windows would not even draw
+		fmt.Fprintln(os.Stderr, "-stage-frames needs -output")
+		os.Exit(2)
+	}
+	if *output != "" && *stage <= 0 {
+		// without windows there are no keypresses to end each stage
+		fmt.Fprintln(os.Stderr, "-output needs -stage-frames")
+		os.Exit(2)
+	}
+
+	var src talk.FrameSource
+	var err error
+	switch {
+	case *video != "":
+		src, err = talk.VideoFileSource(*video)
+	case *frames != "":
+		src, err = talk.ImageDirSource(*frames, false)
+	default:
+		src, err = talk.DeviceSource(*device)
+	}
+	if err != nil {
+		panic(err)
+	}
+	talk.UseFrameSource(src)
+	if *video != "" || *frames != "" {
+		// recorded frames should all be processed, not dropped when detection falls behind
+		talk.UseLockstepPipeline()
+	}
+
+	if *output != "" {
+		debug, err := talk.PNGSequenceSink(filepath.Join(*output, "debug"), "debug")
+		if err != nil {
+			panic(err)
+		}
+		projector, err := talk.PNGSequenceSink(filepath.Join(*output, "projector"), "projector")
+		if err != nil {
+			panic(err)
+		}
+		talk.UseRenderSinks(debug, projector)
+	}
+	if *chess {
+		talk.ForceChessboardCalibration()
+	}
+	if *recal {
+		talk.ForceCalibration()
+	}
+	if *homog {
+		talk.UseHomographyCalibration()
+	}
+	if *cmask {
+		talk.UseColorMask()
+	}
+	if *stage > 0 {
+		talk.UseKeySource(talk.FrameCountKeys(*stage))
+	}
+
 	// instead of using all coloured dots to identify pages, only use the corner dots
+	// talk.UseCheckedIDs() uses the outer dots as parity instead, so misread dots are corrected,
+	// but needs pages printed with those: give their corners in 3 letter shorthand
 	talk.UseSimplifiedIDs()
+	// talk.UseTwoCornerIDs() also recognises pages with two corners covered, but only takes pages
+	// that each pair of their corners identifies; it returns an error if pages added before dont
 
 	//page1
 	//talk.AddPageFromShorthand("ygybr", "brgry", "gbgyg", "bgryy", `(claim this 'outlined 'blue)`)
@@ -20,6 +98,9 @@ func main() {
 	//page2
 	talk.AddPageFromShorthand("yggyg", "rgyrb", "bybbg", "brgrg", `(claim this 'highlighted 'red)`)
 
+	//page marked with aruco markers 0 to 3 instead of dots, see talk.PrintArucoPage
+	//talk.AddArucoPage(0, `(claim this 'highlighted 'blue)`)
+
 	//page that always counts as recognised but doesnt have to be present physically
 	talk.AddBackgroundPage(testpage)
 
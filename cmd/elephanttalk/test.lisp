@@ -40,25 +40,21 @@
         (rect:union (rect:union (rect:union (car rects) (car (cdr rects))) (car (cdr (cdr rects)))) (car (cdr (cdr (cdr rects)))))
        )))
 
-#| TODO: illu (ie gocv.Mat) is not hashable, so cant store it in claim in db. pass by ref? |# 
+#| drawn upright in page space; the canvas is warped onto the page, text included |#
+(when ((highlighted ,?page ,?color)) do
+    (let ((canvas (make-page-canvas ,?page)))
+      #| inset 20% from the edges of the sheet |#
+      (gocv:rect canvas (canvas-rect 4.2 5.94 16.8 23.76) ,?color -1)
+      (gocv:text canvas "TEST" (canvas-point 7.5 15) 2.0 green 4)
+      (claim ,?page 'has-illumination canvas)))
 
-(when ((highlighted ,?page ,?color) ((page points) ,?page ,?points) ((page angle) ,?page ,?angle)) do
-    (let ((center (midpoint (quote ,?points)))
-          (unangle (* -360 (/ ,?angle (* 2 pi))))
-          (illu (make-illumination)))
-      (let ((rotated (map (lambda (p) (rotateAround center p ,?angle)) (quote ,?points)))
-            (m (gocv:rotation_matrix2D (car center) (cdr center) unangle 1.0)))
-        #| TODO: make p->center a unit vector, add in projector-space inches instead of a percentage |#
-        (define inset (lambda (p) (point-add p (point-mul (point-sub center p) 0.2))))
-        (gocv:rect illu (points->rect (map inset rotated)) ,?color -1)
-        (gocv:text illu "TEST" (point2d (car center) (cdr center)) 0.5 green 2)
-        #| might not work because it doesnt support inplace |#
-        (gocv:warp_affine illu illu m 1280 720)
-        (claim ,?page 'has-illumination 'illu))))
+#| illuminations are handles, so other rules can pick them up from claims |#
+(when ((has-illumination ,?page ,?illu) (faded ,?page ,?alpha)) do
+    (ill:alpha ,?illu ,?alpha))
 
 (when ((outlined ,?page ,?color) ((page points) ,?page ,?points)) do
     (let ((pts (quote ,?points))
-          (illu (make-illumination)))
+          (illu (make-illumination ,?page)))
       (let ((ulhc (car pts))
             (urhc (car (cdr pts)))
             (lrhc (car (cdr (cdr pts))))
@@ -74,7 +70,7 @@
 
 (when ((pointing ,?page ,?cm) ((page points) ,?page ,?points)) do
     (let ((pts (quote ,?points))
-          (illu (make-illumination)))
+          (illu (make-illumination ,?page)))
       (let ((ulhc (car pts))
             (urhc (car (cdr pts)))
             (lrhc (car (cdr (cdr pts)))))
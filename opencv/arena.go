@@ -0,0 +1,96 @@
+package opencv
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"gocv.io/x/gocv"
+)
+
+// Arena owns native gocv objects so they can be released together, typically at the end of a frame.
+// Anything registered with an arena must not be closed by anyone else.
+// The frame loop registers what outlives the function creating it: the frame as it moves through
+// the pipeline and everything made from lisp. Temporaries that never leave a function,
+// like those in detect or composite, are closed where they are made instead
+type Arena struct {
+	mu      sync.Mutex
+	closers []closer
+	// see handle.go
+	handles map[Handle]interface{}
+}
+
+type closer interface {
+	Close() error
+}
+
+// counted over all arenas, so tests can check nothing outlives its arena
+var allocated, released atomic.Int64
+
+// ArenaStats are the leak counters of all arenas together
+type ArenaStats struct {
+	// objects registered with an arena, ever
+	Allocated int64
+	// objects closed by releasing their arena
+	Released int64
+}
+
+// Live is the number of objects registered but not released yet
+func (s ArenaStats) Live() int64 {
+	return s.Allocated - s.Released
+}
+
+func Stats() ArenaStats {
+	return ArenaStats{Allocated: allocated.Load(), Released: released.Load()}
+}
+
+func NewArena() *Arena {
+	return &Arena{}
+}
+
+// Mat registers m with the arena and returns it
+func (a *Arena) Mat(m gocv.Mat) gocv.Mat {
+	a.add(&m)
+	return m
+}
+
+// Add registers anything that needs closing, like a gocv.PointVector
+func (a *Arena) Add(c closer) {
+	a.add(c)
+}
+
+func (a *Arena) add(c closer) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.closers = append(a.closers, c)
+	allocated.Add(1)
+}
+
+// Release closes everything registered, newest first, and invalidates its handles.
+// The arena can be reused afterwards
+func (a *Arena) Release() {
+	a.mu.Lock()
+	closers := a.closers
+	a.closers = nil
+	a.handles = nil
+	a.mu.Unlock()
+	for i := len(closers) - 1; i >= 0; i-- {
+		closers[i].Close()
+		released.Add(1)
+	}
+}
+
+// Len is the number of objects currently registered
+func (a *Arena) Len() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return len(a.closers)
+}
+
+// arena used by the lisp bindings for everything they create.
+// Lisp only runs on one goroutine at a time, which sets this before evaluating
+var arena = NewArena()
+
+// UseArena makes the lisp bindings register what they create with a, until the next call
+func UseArena(a *Arena) {
+	arena = a
+}
@@ -0,0 +1,90 @@
+package opencv
+
+import (
+	"testing"
+
+	"github.com/deosjr/whistle/lisp"
+)
+
+func TestArenaReleasesWhatLispCreates(t *testing.T) {
+	old := arena
+	defer func() {
+		UseArena(old)
+		Illus = []*Illumination{}
+	}()
+	if live := Stats().Live(); live != 0 {
+		t.Fatalf("%d objects live before the test", live)
+	}
+
+	l := lisp.New()
+	Load(l.Env)
+	a := NewArena()
+	UseArena(a)
+	for _, expr := range []string{
+		"(define illu (make-illumination 1))",
+		"(define rot (gocv:rotation_matrix2D 10 10 45 1))",
+		"(define r (handle (make-rectangle 0 0 5 5)))",
+		"(gocv:rect illu r red 2)",
+	} {
+		if _, err := l.Eval(expr); err != nil {
+			t.Fatalf("%s: %v", expr, err)
+		}
+	}
+	if live := Stats().Live(); live == 0 || int(live) != a.Len() {
+		t.Fatalf("%d objects live, %d in the arena: want everything lisp made in the arena", live, a.Len())
+	}
+
+	a.Release()
+	if live := Stats().Live(); live != 0 {
+		t.Errorf("%d objects live after releasing the arena, want 0", live)
+	}
+	if _, err := l.Eval("(handle:resolve r)"); err == nil {
+		t.Errorf("handle resolved after its arena was released")
+	}
+}
+
+func TestBuiltinsReturnHandles(t *testing.T) {
+	old := arena
+	defer func() {
+		old.Release()
+		UseArena(old)
+		Illus = []*Illumination{}
+	}()
+
+	l := lisp.New()
+	Load(l.Env)
+	a := NewArena()
+	UseArena(a)
+	for _, expr := range []string{
+		"(point2d 1 2)",
+		"(make-rectangle 0 0 5 5)",
+		"(rect:union (make-rectangle 0 0 5 5) (make-rectangle 2 2 8 8))",
+		"(gocv:rotation_matrix2D 10 10 45 1)",
+	} {
+		e, err := l.Eval(expr)
+		if err != nil {
+			t.Fatalf("%s: %v", expr, err)
+		}
+		h, ok := e.AsPrimitive().(Handle)
+		if !ok {
+			t.Errorf("%s returned %T, want a handle", expr, e.AsPrimitive())
+			continue
+		}
+		if h.arena != a {
+			t.Errorf("%s made a handle in another arena than that of the frame", expr)
+		}
+	}
+
+	// resolving goes by the arena a handle was made in, not the one lisp uses now
+	if _, err := l.Eval("(define r (make-rectangle 0 0 5 5))"); err != nil {
+		t.Fatal(err)
+	}
+	UseArena(NewArena())
+	if _, err := l.Eval("(handle:resolve r)"); err != nil {
+		t.Errorf("handle from an unreleased arena does not resolve: %v", err)
+	}
+	a.Release()
+	if _, err := l.Eval("(handle:resolve r)"); err == nil {
+		t.Errorf("handle resolved after its arena was released")
+	}
+}
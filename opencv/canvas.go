@@ -0,0 +1,21 @@
+package opencv
+
+import (
+	"github.com/deosjr/whistle/lisp"
+	"gocv.io/x/gocv"
+)
+
+// resolution of page canvases: an A4 sheet is 420x594 pixels
+const CanvasPixelsPerCM = 20
+
+const a4WidthCM, a4HeightCM = 21.0, 29.7
+
+// (make-page-canvas page) -> illumination handle, black and sized to the sheet.
+// Canvas pixels are CanvasPixelsPerCM per cm on the sheet, origin in its upper left.
+// The runtime warps each canvas onto its page in the projection using the page pose
+func newPageCanvas(args []lisp.SExpression) (lisp.SExpression, error) {
+	page := int(args[0].AsNumber())
+	w, h := int(a4WidthCM*CanvasPixelsPerCM), int(a4HeightCM*CanvasPixelsPerCM)
+	canvas := gocv.NewMatWithSizeFromScalar(gocv.NewScalar(0, 0, 0, 0), h, w, gocv.MatTypeCV8UC3)
+	return handleTo(addIllumination(canvas, page, true))
+}
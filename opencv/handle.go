@@ -0,0 +1,109 @@
+package opencv
+
+import (
+	"fmt"
+	"image"
+	"sync/atomic"
+
+	"github.com/deosjr/whistle/lisp"
+	"gocv.io/x/gocv"
+)
+
+// Handle is a hashable stand-in for a native object, so it can be stored in a claim.
+// It resolves back to the object only within the arena, usually the frame, it was made in
+type Handle struct {
+	kind  string
+	id    uint64
+	arena *Arena
+}
+
+func (h Handle) String() string {
+	return fmt.Sprintf("#<%s %d>", h.kind, h.id)
+}
+
+// unique across arenas, so a handle from an earlier frame never resolves to something new
+var nextHandle atomic.Uint64
+
+// Handle registers x with the arena and returns a handle to it
+func (a *Arena) Handle(x interface{}) (Handle, error) {
+	var kind string
+	switch x.(type) {
+	case *Illumination:
+		kind = "illumination"
+	case gocv.Mat:
+		kind = "mat"
+	case image.Rectangle:
+		kind = "rect"
+	case image.Point:
+		kind = "point"
+	default:
+		return Handle{}, fmt.Errorf("no handles for %T", x)
+	}
+	h := Handle{kind: kind, id: nextHandle.Add(1), arena: a}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.handles == nil {
+		a.handles = map[Handle]interface{}{}
+	}
+	a.handles[h] = x
+	return h, nil
+}
+
+// Resolve returns the object behind h, if h was made in this arena since it was last released
+func (a *Arena) Resolve(h Handle) (interface{}, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	x, ok := a.handles[h]
+	return x, ok
+}
+
+// natives returns args with handles replaced by what they stand for, looked up in the arena
+// each was made in, so builtins can take either and type assert as usual
+func natives(args []lisp.SExpression) ([]lisp.SExpression, error) {
+	out := make([]lisp.SExpression, len(args))
+	for i, e := range args {
+		out[i] = e
+		if !e.IsPrimitive() {
+			continue
+		}
+		h, ok := e.AsPrimitive().(Handle)
+		if !ok {
+			continue
+		}
+		if h.arena == nil {
+			return nil, fmt.Errorf("%s is not a valid handle", h)
+		}
+		x, ok := h.arena.Resolve(h)
+		if !ok {
+			return nil, fmt.Errorf("%s is from an earlier frame", h)
+		}
+		out[i] = lisp.NewPrimitive(x)
+	}
+	return out, nil
+}
+
+// handleTo registers x with the arena of this frame and returns a handle primitive for it
+func handleTo(x interface{}) (lisp.SExpression, error) {
+	h, err := arena.Handle(x)
+	if err != nil {
+		return nil, err
+	}
+	return lisp.NewPrimitive(h), nil
+}
+
+// (handle x) -> handle primitive for an illumination, mat, rectangle or point
+func newHandle(args []lisp.SExpression) (lisp.SExpression, error) {
+	if _, ok := args[0].AsPrimitive().(Handle); ok {
+		return args[0], nil
+	}
+	return handleTo(args[0].AsPrimitive())
+}
+
+// (handle:resolve h) -> the native primitive behind h
+func resolveHandle(args []lisp.SExpression) (lisp.SExpression, error) {
+	out, err := natives(args[:1])
+	if err != nil {
+		return nil, err
+	}
+	return out[0], nil
+}
@@ -0,0 +1,161 @@
+package opencv
+
+import (
+	"fmt"
+
+	"github.com/deosjr/whistle/lisp"
+	"gocv.io/x/gocv"
+)
+
+// BlendMode is how an illumination is combined with what is drawn below it
+type BlendMode int
+
+const (
+	// replaces what is below, weighed by alpha
+	BlendOver BlendMode = iota
+	// adds to what is below, saturating at white
+	BlendAdd
+	// scales what is below by illumination/255: white keeps it, black removes it
+	BlendMultiply
+)
+
+func (b BlendMode) String() string {
+	switch b {
+	case BlendAdd:
+		return "add"
+	case BlendMultiply:
+		return "multiply"
+	}
+	return "over"
+}
+
+// Illumination is something page code wants projected.
+// The runtime composites all illuminations of a frame in order of Z,
+// ties broken by Page and then by order of creation
+type Illumination struct {
+	Mat gocv.Mat
+	// datalog id of the page that made it, or -1 if it wasnt attributed
+	Page int
+	// drawn in page space and warped onto Page, see canvas.go
+	Canvas bool
+	// opacity in [0,1]
+	Alpha float64
+	Blend BlendMode
+	Z     int
+	// by default black pixels are transparent, so only what was drawn counts.
+	// An opaque illumination covers its whole area, which is how to draw black or dim
+	Opaque bool
+}
+
+// illuminations created this frame, to be composited by the runtime.
+// Their mats belong to the arena they were created in, so are released along with the frame.
+// Lisp gets a handle to each, which unlike the mat can be stored in a claim
+var Illus = []*Illumination{}
+
+func addIllumination(m gocv.Mat, page int, canvas bool) *Illumination {
+	illu := &Illumination{Mat: arena.Mat(m), Page: page, Canvas: canvas, Alpha: 1}
+	Illus = append(Illus, illu)
+	return illu
+}
+
+// (make-illumination page) -> illumination handle in projector space, black.
+// page is usually this: the illumination is composited along with that page
+func newIllumination(args []lisp.SExpression) (lisp.SExpression, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("make-illumination: expected a page, got %d arguments", len(args))
+	}
+	page := int(args[0].AsNumber())
+	// black is what counts as not drawn, see Illumination.Opaque
+	m := gocv.NewMatWithSizeFromScalar(gocv.NewScalar(0, 0, 0, 0), beamerHeight, beamerWidth, gocv.MatTypeCV8UC3)
+	return handleTo(addIllumination(m, page, false))
+}
+
+// illuMat lets drawing builtins take an illumination or a plain gocv.Mat, once resolved
+func illuMat(e lisp.SExpression) (gocv.Mat, error) {
+	switch v := e.AsPrimitive().(type) {
+	case *Illumination:
+		return v.Mat, nil
+	case gocv.Mat:
+		return v, nil
+	}
+	return gocv.Mat{}, fmt.Errorf("%v is not an illumination or mat", e)
+}
+
+// illumination is the illumination behind a resolved handle, as the builtin called name takes it
+func illumination(name string, e lisp.SExpression) (*Illumination, error) {
+	if e.IsPrimitive() {
+		if illu, ok := e.AsPrimitive().(*Illumination); ok {
+			return illu, nil
+		}
+	}
+	return nil, fmt.Errorf("%s: %v is not an illumination", name, e)
+}
+
+// (ill:alpha illu alpha)
+func illuAlpha(args []lisp.SExpression) (lisp.SExpression, error) {
+	native, err := natives(args[:1])
+	if err != nil {
+		return nil, err
+	}
+	illu, err := illumination("ill:alpha", native[0])
+	if err != nil {
+		return nil, err
+	}
+	a := args[1].AsNumber()
+	if a < 0 || a > 1 {
+		return nil, fmt.Errorf("ill:alpha: %v not in [0,1]", a)
+	}
+	illu.Alpha = a
+	return args[0], nil
+}
+
+// (ill:blend illu 'over|'add|'multiply)
+func illuBlend(args []lisp.SExpression) (lisp.SExpression, error) {
+	native, err := natives(args[:1])
+	if err != nil {
+		return nil, err
+	}
+	illu, err := illumination("ill:blend", native[0])
+	if err != nil {
+		return nil, err
+	}
+	switch mode := args[1].AsSymbol(); mode {
+	case "over":
+		illu.Blend = BlendOver
+	case "add":
+		illu.Blend = BlendAdd
+	case "multiply":
+		illu.Blend = BlendMultiply
+	default:
+		return nil, fmt.Errorf("ill:blend: unknown mode %s", mode)
+	}
+	return args[0], nil
+}
+
+// (ill:z illu z)
+func illuZ(args []lisp.SExpression) (lisp.SExpression, error) {
+	native, err := natives(args[:1])
+	if err != nil {
+		return nil, err
+	}
+	illu, err := illumination("ill:z", native[0])
+	if err != nil {
+		return nil, err
+	}
+	illu.Z = int(args[1].AsNumber())
+	return args[0], nil
+}
+
+// (ill:opaque illu)
+func illuOpaque(args []lisp.SExpression) (lisp.SExpression, error) {
+	native, err := natives(args[:1])
+	if err != nil {
+		return nil, err
+	}
+	illu, err := illumination("ill:opaque", native[0])
+	if err != nil {
+		return nil, err
+	}
+	illu.Opaque = true
+	return args[0], nil
+}
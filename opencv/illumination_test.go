@@ -0,0 +1,48 @@
+package opencv
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/deosjr/whistle/lisp"
+)
+
+func TestIlluminationSettersRejectOtherHandles(t *testing.T) {
+	old := arena
+	defer func() {
+		old.Release()
+		UseArena(old)
+		Illus = []*Illumination{}
+	}()
+
+	l := lisp.New()
+	Load(l.Env)
+	UseArena(NewArena())
+	for _, expr := range []string{
+		"(define illu (make-illumination 1))",
+		"(define r (make-rectangle 0 0 5 5))",
+	} {
+		if _, err := l.Eval(expr); err != nil {
+			t.Fatalf("%s: %v", expr, err)
+		}
+	}
+	for _, tt := range []struct {
+		set, call string
+	}{
+		{"alpha", "(ill:alpha %s 0.5)"},
+		{"blend", "(ill:blend %s (quote add))"},
+		{"z", "(ill:z %s 2)"},
+		{"opaque", "(ill:opaque %s)"},
+	} {
+		if _, err := l.Eval(fmt.Sprintf(tt.call, "illu")); err != nil {
+			t.Errorf("setting %s on an illumination: %v", tt.set, err)
+		}
+		if _, err := l.Eval(fmt.Sprintf(tt.call, "r")); err == nil {
+			t.Errorf("set %s on a rectangle without error", tt.set)
+		}
+	}
+	illu := Illus[0]
+	if illu.Alpha != 0.5 || illu.Blend != BlendAdd || illu.Z != 2 || !illu.Opaque {
+		t.Errorf("illumination set to %+v", *illu)
+	}
+}
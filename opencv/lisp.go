@@ -23,8 +23,19 @@ func Load(env *lisp.Env) {
 	env.Add("green", lisp.NewPrimitive(color.RGBA{0, 255, 0, 0}))
 	env.Add("blue", lisp.NewPrimitive(color.RGBA{0, 0, 255, 0}))
 
-	// illumination is a gocv mat
+	// illumination wraps a gocv mat, see illumination.go; lisp gets a handle to it
 	env.AddBuiltin("make-illumination", newIllumination)
+	// a canvas is an illumination drawn in page space, see canvas.go
+	env.AddBuiltin("make-page-canvas", newPageCanvas)
+	env.Add("canvasPixelsPerCM", lisp.NewPrimitive(float64(CanvasPixelsPerCM)))
+	// how an illumination is composited into the projection
+	env.AddBuiltin("ill:alpha", illuAlpha)
+	env.AddBuiltin("ill:blend", illuBlend)
+	env.AddBuiltin("ill:z", illuZ)
+	env.AddBuiltin("ill:opaque", illuOpaque)
+	// handles stand in for native objects in claims, see handle.go
+	env.AddBuiltin("handle", newHandle)
+	env.AddBuiltin("handle:resolve", resolveHandle)
 	// TODO: once we explore declarations in projectionspace vs rotation a bit more
 	//env.AddBuiltin("ill:rectangle", illuRectangle)
 
@@ -48,89 +59,113 @@ func Load(env *lisp.Env) {
 	env.AddBuiltin("sqrt", sqrt)
 }
 
-// TODO: defer close? memory leak otherwise?
-// dont want to write close in lisp, so for now we'll need some memory mngment
-// outside of it (ie keeping track in Go of created mats and closing them)
-// NOTE: gocv.Mat is unhashable, so we cant even store it in datalog anyways
-var Illus = []gocv.Mat{}
-
-func newIllumination(args []lisp.SExpression) (lisp.SExpression, error) {
-	illu := gocv.NewMatWithSize(beamerHeight, beamerWidth, gocv.MatTypeCV8UC3)
-	Illus = append(Illus, illu)
-	return lisp.NewPrimitive(illu), nil
-}
-
 // (gocv:line illu p q color fill)
 func gocvLine(args []lisp.SExpression) (lisp.SExpression, error) {
-	illu := args[0].AsPrimitive().(gocv.Mat)
-	p := args[1].AsPrimitive().(image.Point)
-	q := args[2].AsPrimitive().(image.Point)
-	c := args[3].AsPrimitive().(color.RGBA)
-	fill := int(args[4].AsNumber())
+	native, err := natives(args)
+	if err != nil {
+		return nil, err
+	}
+	illu, err := illuMat(native[0])
+	if err != nil {
+		return nil, err
+	}
+	p := native[1].AsPrimitive().(image.Point)
+	q := native[2].AsPrimitive().(image.Point)
+	c := native[3].AsPrimitive().(color.RGBA)
+	fill := int(native[4].AsNumber())
 	gocv.Line(&illu, p, q, c, fill)
-	return lisp.NewPrimitive(illu), nil
+	return args[0], nil
 }
 
 // (gocv:rect illu rect color fill)
 func gocvRectangle(args []lisp.SExpression) (lisp.SExpression, error) {
-	illu := args[0].AsPrimitive().(gocv.Mat)
-	rect := args[1].AsPrimitive().(image.Rectangle)
-	c := args[2].AsPrimitive().(color.RGBA)
-	fill := int(args[3].AsNumber())
+	native, err := natives(args)
+	if err != nil {
+		return nil, err
+	}
+	illu, err := illuMat(native[0])
+	if err != nil {
+		return nil, err
+	}
+	rect := native[1].AsPrimitive().(image.Rectangle)
+	c := native[2].AsPrimitive().(color.RGBA)
+	fill := int(native[3].AsNumber())
 	gocv.Rectangle(&illu, rect, c, fill)
-	return lisp.NewPrimitive(illu), nil
+	return args[0], nil
 }
 
 // TODO: cant pick a font yet
-// NOTE: text cant be drawn at an angle, so has to be drawn then rotated
+// NOTE: text cant be drawn at an angle, so has to be drawn then rotated; or drawn on a page canvas
 // (gocv:text illu text origin scale color fill)
 func gocvText(args []lisp.SExpression) (lisp.SExpression, error) {
-	illu := args[0].AsPrimitive().(gocv.Mat)
-	txt := args[1].AsPrimitive().(string)
-	origin := args[2].AsPrimitive().(image.Point)
-	scale := args[3].AsNumber()
-	c := args[4].AsPrimitive().(color.RGBA)
-	fill := int(args[5].AsNumber())
+	native, err := natives(args)
+	if err != nil {
+		return nil, err
+	}
+	illu, err := illuMat(native[0])
+	if err != nil {
+		return nil, err
+	}
+	txt := native[1].AsPrimitive().(string)
+	origin := native[2].AsPrimitive().(image.Point)
+	scale := native[3].AsNumber()
+	c := native[4].AsPrimitive().(color.RGBA)
+	fill := int(native[5].AsNumber())
 	gocv.PutText(&illu, txt, origin, gocv.FontHersheySimplex, scale, c, fill)
-	return lisp.NewPrimitive(illu), nil
+	return args[0], nil
 }
 
-// (gocv:rotation_matrix2D cx cy degrees scale)
+// (gocv:rotation_matrix2D cx cy degrees scale) -> mat handle
 func rotationMatrix(args []lisp.SExpression) (lisp.SExpression, error) {
 	x, y := int(args[0].AsNumber()), int(args[1].AsNumber())
 	degrees := args[2].AsNumber()
 	scale := args[3].AsNumber()
-	return lisp.NewPrimitive(gocv.GetRotationMatrix2D(image.Pt(x, y), degrees, scale)), nil
+	return handleTo(arena.Mat(gocv.GetRotationMatrix2D(image.Pt(x, y), degrees, scale)))
 }
 
 // (gocv:warp_affine src dst m sx sy)
 func warpAffine(args []lisp.SExpression) (lisp.SExpression, error) {
-	src := args[0].AsPrimitive().(gocv.Mat)
-	dst := args[1].AsPrimitive().(gocv.Mat)
-	m := args[2].AsPrimitive().(gocv.Mat)
-	x, y := int(args[3].AsNumber()), int(args[4].AsNumber())
+	native, err := natives(args)
+	if err != nil {
+		return nil, err
+	}
+	src, err := illuMat(native[0])
+	if err != nil {
+		return nil, err
+	}
+	dst, err := illuMat(native[1])
+	if err != nil {
+		return nil, err
+	}
+	m := native[2].AsPrimitive().(gocv.Mat)
+	x, y := int(native[3].AsNumber()), int(native[4].AsNumber())
 	gocv.WarpAffine(src, &dst, m, image.Pt(x, y))
 	return lisp.NewPrimitive(true), nil
 }
 
-// (point2D x y) -> image.Point primitive
+// (point2D x y) -> point handle
 func newPoint2D(args []lisp.SExpression) (lisp.SExpression, error) {
 	x, y := int(args[0].AsNumber()), int(args[1].AsNumber())
-	return lisp.NewPrimitive(image.Pt(x, y)), nil
+	return handleTo(image.Pt(x, y))
 }
 
-// (make-rectangle minx miny maxx maxy) -> image.Rectangle primitive
+// (make-rectangle minx miny maxx maxy) -> rectangle handle
 func newRectangle(args []lisp.SExpression) (lisp.SExpression, error) {
 	px, py := int(args[0].AsNumber()), int(args[1].AsNumber())
 	qx, qy := int(args[2].AsNumber()), int(args[3].AsNumber())
 	r := image.Rectangle{image.Pt(px, py), image.Pt(qx, qy)}
-	return lisp.NewPrimitive(r), nil
+	return handleTo(r)
 }
 
+// (rect:union r1 r2) -> rectangle handle
 func rectUnion(args []lisp.SExpression) (lisp.SExpression, error) {
-	r1 := args[0].AsPrimitive().(image.Rectangle)
-	r2 := args[1].AsPrimitive().(image.Rectangle)
-	return lisp.NewPrimitive(r1.Union(r2)), nil
+	native, err := natives(args)
+	if err != nil {
+		return nil, err
+	}
+	r1 := native[0].AsPrimitive().(image.Rectangle)
+	r2 := native[1].AsPrimitive().(image.Rectangle)
+	return handleTo(r1.Union(r2))
 }
 
 func sine(args []lisp.SExpression) (lisp.SExpression, error) {
@@ -0,0 +1,236 @@
+package talk
+
+import (
+	"image"
+	"image/color"
+
+	"gocv.io/x/gocv"
+)
+
+// Aruco pages have a black and white square marker in each corner instead of coloured dots,
+// which unlike dots still read fine under coloured projector light.
+// Page n has markers 4n to 4n+3, clockwise from ulhc. Each is printed upright, arucoMarkerCM wide,
+// with its own corner on the outside of the page at the corner top. Arms of the corner run along
+// the edges of the marker: corner k of a page is marker corner k, its left and right arm end
+// at marker corners k-1 and k+1, so it lines up with a dot corner of the same page
+
+const arucoDictionary = gocv.ArucoDict4x4_1000
+
+// pages that fit in the dictionary
+const arucoPages = 1000 / 4
+
+// printed width of a marker, which arucoCenter scales by. Not the 5cm arms of a dot corner:
+// arms of an aruco corner end at the marker corners, so they are this long
+const arucoMarkerCM = 4.0
+
+// sets aruco page ids apart from dot page ids
+const arucoPageBit = uint64(1) << 63
+
+func arucoPage(n int, code string) page {
+	cs := [4]corner{}
+	for i := range cs {
+		cs[i] = corner{ll: dot{c: unknownDot}, l: dot{c: unknownDot}, m: dot{c: unknownDot}, r: dot{c: unknownDot}, rr: dot{c: unknownDot}}
+	}
+	return page{
+		id:       arucoPageBit | uint64(n),
+		fiducial: arucoFiducial,
+		ulhc:     cs[0],
+		urhc:     cs[1],
+		lrhc:     cs[2],
+		llhc:     cs[3],
+		code:     code,
+	}
+}
+
+// arucoNumber is the page number of an aruco page
+func arucoNumber(p page) int {
+	return int(p.id &^ arucoPageBit)
+}
+
+func arucoKey(n int) pageKey {
+	return pageKey{fiducial: arucoFiducial, id: uint64(n)}
+}
+
+// AddArucoPage adds page number n, marked with aruco markers 4n to 4n+3, to the database
+func AddArucoPage(n int, code string) bool {
+	if n < 0 || n >= arucoPages {
+		return false
+	}
+	if _, ok := pageDB[arucoKey(n)]; ok {
+		return false
+	}
+	pageDB[arucoKey(n)] = pageView{page: arucoPage(n, code)}
+	return true
+}
+
+// arucoPagesRegistered reports whether any page in the db is marked with aruco markers
+func arucoPagesRegistered() bool {
+	for k := range pageDB {
+		if k.fiducial == arucoFiducial {
+			return true
+		}
+	}
+	return false
+}
+
+// arucoRecognizer finds aruco pages using the aruco module of opencv
+type arucoRecognizer struct {
+	detector gocv.ArucoDetector
+}
+
+func newArucoRecognizer() *arucoRecognizer {
+	dict := gocv.GetPredefinedDictionary(arucoDictionary)
+	return &arucoRecognizer{detector: gocv.NewArucoDetectorWithParams(dict, gocv.NewArucoDetectorParameters())}
+}
+
+func (ar *arucoRecognizer) Close() {
+	ar.detector.Close()
+}
+
+func (ar *arucoRecognizer) recognise(img, clean gocv.Mat, _ partition) []page {
+	green := color.RGBA{0, 255, 0, 0}
+	blue := color.RGBA{0, 0, 255, 0}
+
+	pages := []page{}
+	markers, markerIDs, _ := ar.detector.DetectMarkers(clean)
+	// copies of pages seen, by page number
+	seen := map[int][]*arucoCopy{}
+	for i, id := range markerIDs {
+		n, k := id/4, id%4
+		if _, ok := pageDB[arucoKey(n)]; !ok {
+			continue
+		}
+		pts := make([]point, 4)
+		for j, pt := range markers[i] {
+			pts[j] = point{float64(pt.X), float64(pt.Y)}
+		}
+		for j := range pts {
+			gocv.Line(&img, pts[j].toIntPt(), pts[(j+1)%4].toIntPt(), blue, 2)
+		}
+		gocv.Circle(&img, pts[k].toIntPt(), 8, green, -1)
+		c := arucoCorner(pts, k)
+		seen[n] = addToCopy(seen[n], c, k)
+	}
+
+	for n, copies := range seen {
+		for _, cp := range copies {
+			if p, ok := cp.page(pageDB[arucoKey(n)].page); ok {
+				pages = append(pages, p)
+			}
+		}
+	}
+	return pages
+}
+
+// arucoCopy is one physical copy of an aruco page: the markers of a page are on the same copy
+// if they agree on where its center is
+type arucoCopy struct {
+	center point
+	// by corner, clockwise from ulhc
+	corners map[int]corner
+}
+
+// addToCopy adds corner k to the copy whose center it agrees with, or to a new copy
+func addToCopy(copies []*arucoCopy, c corner, k int) []*arucoCopy {
+	center := arucoCenter(c, k)
+	// within a marker of each other
+	maxDist := euclidian(c.rr.p.sub(c.m.p))
+	for _, cp := range copies {
+		if _, ok := cp.corners[k]; ok {
+			continue
+		}
+		if euclidian(cp.center.sub(center)) < maxDist {
+			cp.corners[k] = c
+			return copies
+		}
+	}
+	return append(copies, &arucoCopy{center: center, corners: map[int]corner{k: c}})
+}
+
+// arucoCenter is the center of a page as seen from the marker in its corner k alone,
+// which we know the printed size of
+func arucoCenter(c corner, k int) point {
+	right, left := c.rr.p.sub(c.m.p), c.ll.p.sub(c.m.p)
+	perCM := euclidian(right) / arucoMarkerCM
+	center := c.m.p.add(unit(right).mul(sideCM(k) / 2 * perCM))
+	return center.add(unit(left).mul(sideCM(k+3) / 2 * perCM))
+}
+
+// page places p where we see this copy of it.
+// Unlike dot corners, each marker tells us which corner it is,
+// so two corners identify a page even without two corner ids
+func (cp *arucoCopy) page(p page) (page, bool) {
+	cs := cp.corners
+	var all []corner
+	// which corner all[0] is
+	first := 0
+	switch len(cs) {
+	case 4:
+		all = []corner{cs[0], cs[1], cs[2], cs[3]}
+	case 3:
+		for k := 0; k < 4; k++ {
+			if _, ok := cs[k]; ok {
+				continue
+			}
+			first = (k + 1) % 4
+			all = []corner{cs[(k+1)%4], cs[(k+2)%4], cs[(k+3)%4]}
+			all = append(all, missingCorner(all))
+		}
+	case 2:
+		for k := 0; k < 4 && all == nil; k++ {
+			c, ok := cs[k]
+			if !ok {
+				continue
+			}
+			first = k
+			if next, ok := cs[(k+1)%4]; ok {
+				all = completeAdjacent(c, next, k)
+			} else if o, ok := cs[(k+2)%4]; ok {
+				all = completeDiagonal(c, o, k)
+			}
+		}
+	}
+	if all == nil {
+		return page{}, false
+	}
+	return placePage(p, first, all), true
+}
+
+// arucoCorner is page corner k as seen from its marker, whose corners pts are clockwise from its upper left
+func arucoCorner(pts []point, k int) corner {
+	m, ll, rr := pts[k], pts[(k+3)%4], pts[(k+1)%4]
+	return corner{
+		ll: dot{p: ll, c: unknownDot},
+		l:  dot{p: m.add(ll).div(2), c: unknownDot},
+		m:  dot{p: m, c: unknownDot},
+		r:  dot{p: m.add(rr).div(2), c: unknownDot},
+		rr: dot{p: rr, c: unknownDot},
+	}
+}
+
+// printArucoMarkers draws the 4 markers of aruco page number n on img, printed at 300dpi
+func printArucoMarkers(img *gocv.Mat, n int) {
+	w, h := img.Cols(), img.Rows()
+	// 1cm in pixels
+	cm := 118
+	side := int(arucoMarkerCM * float64(cm))
+	margin := int(cornerTopsCM[0].x * float64(cm))
+	// upper left of each marker, clockwise from ulhc
+	origins := []image.Point{
+		image.Pt(margin, margin),
+		image.Pt(w-margin-side, margin),
+		image.Pt(w-margin-side, h-margin-side),
+		image.Pt(margin, h-margin-side),
+	}
+	for k, o := range origins {
+		marker := gocv.NewMat()
+		gocv.ArucoGenerateImageMarker(arucoDictionary, 4*n+k, side, marker, 1)
+		bgr := gocv.NewMat()
+		gocv.CvtColor(marker, &bgr, gocv.ColorGrayToBGR)
+		region := img.Region(image.Rectangle{Min: o, Max: o.Add(image.Pt(side, side))})
+		bgr.CopyTo(&region)
+		region.Close()
+		bgr.Close()
+		marker.Close()
+	}
+}
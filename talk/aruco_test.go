@@ -0,0 +1,98 @@
+package talk
+
+import (
+	"math"
+	"testing"
+)
+
+// arucoSquares are the marker squares of an aruco page seen rotated by angle and scaled to pixelsPerCM,
+// each clockwise from its upper left like DetectMarkers finds them
+func arucoSquares(origin point, angle, pixelsPerCM float64) [4][]point {
+	square := []point{{0, 0}, {arucoMarkerCM, 0}, {arucoMarkerCM, arucoMarkerCM}, {0, arucoMarkerCM}}
+	var markers [4][]point
+	for k, top := range cornerTopsCM {
+		// corner k of marker k is on corner top k
+		for _, p := range square {
+			cm := top.add(p.sub(square[k]))
+			markers[k] = append(markers[k], origin.add(rotateAround(point{}, cm.mul(pixelsPerCM), angle)))
+		}
+	}
+	return markers
+}
+
+// seenCopy is one copy of an aruco page, of which we see the markers of corners ks
+type seenCopy struct {
+	origin             point
+	angle, pixelsPerCM float64
+	ks                 []int
+}
+
+func (s seenCopy) center() point {
+	mid := point{a4WidthCM / 2, a4HeightCM / 2}
+	return s.origin.add(rotateAround(point{}, mid.mul(s.pixelsPerCM), s.angle))
+}
+
+func TestArucoCopies(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		copies []seenCopy
+	}{
+		{"all markers", []seenCopy{{point{100, 100}, 0, 10, []int{0, 1, 2, 3}}}},
+		{"three markers", []seenCopy{{point{300, 50}, 0.5, 8, []int{3, 0, 2}}}},
+		{"two adjacent markers", []seenCopy{{point{300, 50}, 0.5, 8, []int{2, 1}}}},
+		{"two diagonal markers", []seenCopy{{point{400, 100}, 1.2, 12, []int{1, 3}}}},
+		{"two copies far apart", []seenCopy{
+			{point{100, 100}, 0, 10, []int{0, 1, 2, 3}},
+			{point{900, 150}, 0.3, 10, []int{0, 1, 2, 3}},
+		}},
+		{"two copies of two and three markers", []seenCopy{
+			{point{100, 100}, -0.2, 10, []int{0, 2}},
+			{point{900, 150}, math.Pi, 10, []int{1, 2, 3}},
+		}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			// markers are found in any order, here interleaved between copies
+			var copies []*arucoCopy
+			for i := 0; i < 4; i++ {
+				for _, s := range tt.copies {
+					if i >= len(s.ks) {
+						continue
+					}
+					k := s.ks[i]
+					copies = addToCopy(copies, arucoCorner(arucoSquares(s.origin, s.angle, s.pixelsPerCM)[k], k), k)
+				}
+			}
+			if len(copies) != len(tt.copies) {
+				t.Fatalf("grouped markers into %d copies, want %d", len(copies), len(tt.copies))
+			}
+			for i, s := range tt.copies {
+				cp := copies[i]
+				if len(cp.corners) != len(s.ks) {
+					t.Errorf("copy %d has %d markers, want %d", i, len(cp.corners), len(s.ks))
+				}
+				if !closeTo(cp.center, s.center(), 1e-6) {
+					t.Errorf("copy %d centred at %v, want %v", i, cp.center, s.center())
+				}
+				p, ok := cp.page(arucoPage(3, ""))
+				if !ok {
+					t.Fatalf("copy %d not placed", i)
+				}
+				markers := arucoSquares(s.origin, s.angle, s.pixelsPerCM)
+				for k, c := range []corner{p.ulhc, p.urhc, p.lrhc, p.llhc} {
+					if want := markers[k][k]; !closeTo(c.m.p, want, 1e-6) {
+						t.Errorf("copy %d: corner %d placed at %v, want %v", i, k, c.m.p, want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestArucoCopyOfOneMarker(t *testing.T) {
+	k := 2
+	c := arucoCorner(arucoSquares(point{100, 100}, 0, 10)[k], k)
+	copies := addToCopy(nil, c, k)
+	if _, ok := copies[0].page(arucoPage(3, "")); ok {
+		t.Errorf("placed a page from one marker")
+	}
+}
@@ -30,10 +30,28 @@ type calibrationResults struct {
 	displacement    point
 	displayRatio    float64
 	referenceColors []color.RGBA
-	scChsBrd        straightChessboard
+	// learned per dotColor, see colorClassifier
+	colorModels []colorModel
+	// 3D lab histograms per dotColor, back projected to classify dots instead of colorModels
+	histograms []gocv.Mat
+	// straightened webcam to beamer mapping, refining the straightening from calibration.json if set
+	homography homography
+	// resolutions at which calibration took place
+	webcamSize, beamerSize image.Point
 }
 
-func calibration(webcam *gocv.VideoCapture, debugwindow, projection *gocv.Window) calibrationResults {
+// Close releases the histograms, the only mats calibration results hold
+func (cr calibrationResults) Close() {
+	closeMats(cr.histograms)
+}
+
+func closeMats(ms []gocv.Mat) {
+	for _, m := range ms {
+		m.Close()
+	}
+}
+
+func calibration(webcam FrameSource, debugwindow, projection RenderSink, keys KeySource) calibrationResults {
 	//calibrationPage()
 
 	// Step 1: set up beamer + webcam at a surface
@@ -44,7 +62,12 @@ func calibration(webcam *gocv.VideoCapture, debugwindow, projection *gocv.Window
 	// TODO probably rename these
 	// img: debug window output from camera
 	// cimg: projector window
-	scChsBrd := loadCalibration("calibration.json")
+	scChsBrd, err := loadCalibration(calibrationFile)
+	if err != nil {
+		fmt.Println(err)
+		return calibrationResults{}
+	}
+	defer scChsBrd.Close()
 
 	img := gocv.NewMat()
 	defer img.Close()
@@ -52,9 +75,7 @@ func calibration(webcam *gocv.VideoCapture, debugwindow, projection *gocv.Window
 	cimg := gocv.NewMatWithSize(beamerHeight, beamerWidth, gocv.MatTypeCV8UC3)
 	defer cimg.Close()
 	red := color.RGBA{255, 0, 0, 0}
-	green := color.RGBA{0, 255, 0, 0}
 	blue := color.RGBA{0, 0, 255, 0}
-	yellow := color.RGBA{255, 255, 0, 0}
 
 	w, h := beamerWidth/2., beamerHeight/2.
 	gocv.Line(&cimg, image.Pt(w-5, h), image.Pt(w+5, h), red, 2)
@@ -67,24 +88,21 @@ func calibration(webcam *gocv.VideoCapture, debugwindow, projection *gocv.Window
 		webcam:      webcam,
 		debugWindow: debugwindow,
 		projection:  projection,
+		keys:        keys,
 		img:         img,
 		cimg:        cimg,
 		scChsBrd:    scChsBrd,
 	}
 
-	if err := frameloop(fi, func(_ image.Image, spatialPartition map[image.Rectangle][]circle) {
+	if _, err := frameloop(fi, func(img, _ gocv.Mat, _ image.Image, spatialPartition partition) {
 		// find calibration pattern, draw around it
-		for k, v := range spatialPartition {
+		for k, v := range spatialPartition.cells {
 			if !findCalibrationPattern(v) {
 				continue
 			}
-			sortCirclesAsCorners(v)
+			sortCirclesAsGrid(v, calibrationCols())
 			gocv.Rectangle(&img, k, red, 2)
-			r := image.Rectangle{
-				v[0].mid.add(point{-v[0].r, -v[0].r}).toIntPt(),
-				v[3].mid.add(point{v[3].r, v[3].r}).toIntPt(),
-			}
-			gocv.Rectangle(&img, r, blue, 2)
+			gocv.Rectangle(&img, circlesRect(v), blue, 2)
 
 			// TODO: draw indicators for horizontal/vertical align
 			pattern = v
@@ -96,26 +114,26 @@ func calibration(webcam *gocv.VideoCapture, debugwindow, projection *gocv.Window
 
 	// keypress breaks the loop, assume pattern is found over midpoint
 	// draw conclusions about colors and distances
-	webcamMid := circlesMidpoint(pattern)
-	// average over all 4 distances to circles in pattern
-	dpixels := euclidian(pattern[0].mid.sub(webcamMid))
-	dpixels += euclidian(pattern[1].mid.sub(webcamMid))
-	dpixels += euclidian(pattern[2].mid.sub(webcamMid))
-	dpixels += euclidian(pattern[3].mid.sub(webcamMid))
-	dpixels = dpixels / 4.
-	dcm := math.Sqrt(1.5*1.5 + 1.5*1.5)
+	webcamMid := calibrationCenter(pattern)
+	// average over all distances between neighbouring circles in pattern
+	dpixels := calibrationSpacing(pattern)
 
 	// just like for printing 1cm = 118px, we need a new ratio for projections
-	// NOTE: pixPerCM lives in webcamspace, NOT beamerspace
-	pixPerCM := dpixels / dcm
+	// NOTE: pixPerCM lives in straightened webcamspace, NOT beamerspace
+	pixPerCM := dpixels / calibrationSpacingCM
 
-	// beamer midpoint vs webcam midpoint displacement
+	// beamer midpoint vs webcam midpoint displacement, left over after straightening
 	beamerMid := point{float64(w), float64(h)}
-	displacement := beamerMid.sub(webcamMid)
-
-	// get color samples of the four dots as reference values
-	var colorSamples []color.RGBA
-	for {
+	displacement := beamerMid.sub(straightToBeamer(webcamMid))
+
+	// get color samples of the dots as reference values,
+	// and learn a colour model for each over a few frames.
+	// sorted as a grid, the calibration page dots are in palette order: same order as dotColor
+	const sampleFrames = 10
+	colorSamples := make([]color.RGBA, len(palette))
+	dotSamples := make([][]lab, len(palette))
+	frames := []gocv.Mat{}
+	for frame := 0; frame < sampleFrames; {
 		if ok := webcam.Read(&img); !ok {
 			fmt.Printf("cannot read device\n")
 			return calibrationResults{}
@@ -124,73 +142,99 @@ func calibration(webcam *gocv.VideoCapture, debugwindow, projection *gocv.Window
 			continue
 		}
 
-		actualImage, _ := img.ToImage()
-		if colorSamples == nil {
-			// TODO: average within the circle?
-			colorSamples = make([]color.RGBA, 4)
-			for i, circle := range pattern {
-				c := actualImage.At(int(circle.mid.x), int(circle.mid.y))
-				rr, gg, bb, _ := c.RGBA()
-				colorSamples[i] = color.RGBA{uint8(rr), uint8(gg), uint8(bb), 0}
+		// sample in straightened space, where the pattern was found
+		straightImage := beamerToChessboard(img, scChsBrd)
+		actualImage, _ := straightImage.ToImage()
+		frames = append(frames, straightImage)
+		for i, circle := range pattern {
+			if frame == 0 {
+				colorSamples[i] = averageColor(actualImage, circle.mid, circle.r)
 			}
+			dotSamples[i] = append(dotSamples[i], sampleDot(actualImage, circle.mid, circle.r)...)
 		}
-		break
+		frame++
+	}
+	colorModels := make([]colorModel, len(palette))
+	for i, samples := range dotSamples {
+		colorModels[i] = learnColorModel(samples, colorSamples[i])
+	}
+
+	histograms := colorHistograms(frames, pattern)
+	for _, f := range frames {
+		f.Close()
 	}
 
 	// project another reference point and calculate diff between webcam-space and projector-space
 	// ratio between webcam and beamer
 	displayRatio := 1.0
 
-	if err := frameloop(fi, func(_ image.Image, spatialPartition map[image.Rectangle][]circle) {
+	// with homography calibration we project a pattern instead of asking to move the page
+	var hom homography
+	if useHomography {
+		var err error
+		hom, err = structuredLightCalibration(fi, 100)
+		if err != nil {
+			fmt.Println(err)
+			closeMats(histograms)
+			return calibrationResults{}
+		}
+	} else if _, err := frameloop(fi, func(img, _ gocv.Mat, _ image.Image, spatialPartition partition) {
 		gocv.Rectangle(&cimg, image.Rect(0, 0, beamerWidth, beamerHeight), color.RGBA{}, -1)
 		gocv.Line(&cimg, image.Pt(w-5+200, h), image.Pt(w+5+200, h), red, 2)
 		gocv.Line(&cimg, image.Pt(w+200., h-5), image.Pt(w+200, h+5), red, 2)
 		gocv.PutText(&cimg, "Place calibration pattern", image.Pt(w-100+200, h+50), 0, .5, color.RGBA{255, 255, 255, 0}, 2)
 
 		// find calibration pattern, draw around it
-		for k, v := range spatialPartition {
+		for k, v := range spatialPartition.cells {
 			if !findCalibrationPattern(v) {
 				continue
 			}
-			sortCirclesAsCorners(v)
+			sortCirclesAsGrid(v, calibrationCols())
 			gocv.Rectangle(&img, k, red, 2)
-			r := image.Rectangle{
-				v[0].mid.add(point{-v[0].r, -v[0].r}).toIntPt(),
-				v[3].mid.add(point{v[3].r, v[3].r}).toIntPt(),
-			}
-			gocv.Rectangle(&img, r, blue, 2)
+			gocv.Rectangle(&img, circlesRect(v), blue, 2)
 
-			midpoint := circlesMidpoint(v)
+			midpoint := calibrationCenter(v)
 			// assume Y component stays 0 (i.e. we are horizontally aligned between webcam and beamer)
-			displayRatio = midpoint.sub(webcamMid).x / 200.0
+			displayRatio = straightToBeamer(midpoint).sub(straightToBeamer(webcamMid)).x / 200.0
 
 			// projecting the draw ratio difference
-			withoutRatio := midpoint.add(displacement).toIntPt()
+			withoutRatio := straightToBeamer(midpoint).add(displacement).toIntPt()
 			gocv.Line(&cimg, beamerMid.toIntPt(), withoutRatio, blue, 2)
 
 			// TODO: draw indicators for horizontal/vertical align
 			pattern = v
 		}
 
-		gocv.Circle(&img, image.Pt(10, 10), 10, colorSamples[0], -1)
-		gocv.Circle(&img, image.Pt(30, 10), 10, colorSamples[1], -1)
-		gocv.Circle(&img, image.Pt(50, 10), 10, colorSamples[2], -1)
-		gocv.Circle(&img, image.Pt(70, 10), 10, colorSamples[3], -1)
+		for i, c := range colorSamples {
+			gocv.Circle(&img, image.Pt(10+20*i, 10), 10, c, -1)
+		}
 
 	}, colorSamples, 100); err != nil {
+		closeMats(histograms)
 		return calibrationResults{}
 	}
 
-	if err := frameloop(fi, func(actualImage image.Image, spatialPartition map[image.Rectangle][]circle) {
+	cResults := calibrationResults{
+		pixelsPerCM:     pixPerCM,
+		displacement:    displacement,
+		displayRatio:    displayRatio,
+		referenceColors: colorSamples,
+		colorModels:     colorModels,
+		histograms:      histograms,
+		homography:      hom,
+		beamerSize:      image.Pt(beamerWidth, beamerHeight),
+	}
+
+	if _, err := frameloop(fi, func(img, _ gocv.Mat, actualImage image.Image, spatialPartition partition) {
 		gocv.Rectangle(&cimg, image.Rect(0, 0, beamerWidth, beamerHeight), color.RGBA{}, -1)
 
-		for k, v := range spatialPartition {
+		for k, v := range spatialPartition.cells {
 			if !findCalibrationPattern(v) {
 				continue
 			}
-			sortCirclesAsCorners(v)
+			sortCirclesAsGrid(v, calibrationCols())
 
-			colorDiff := make([]float64, 4)
+			colorDiff := make([]float64, len(v))
 			for i, circle := range v {
 				c := actualImage.At(int(circle.mid.x), int(circle.mid.y))
 				colorDiff[i] = colorDistance(c, colorSamples[i])
@@ -199,42 +243,152 @@ func calibration(webcam *gocv.VideoCapture, debugwindow, projection *gocv.Window
 			// unless ofc lighting changes drastically
 
 			gocv.Rectangle(&img, k, red, 2)
-			r := image.Rectangle{
-				v[0].mid.add(point{-v[0].r, -v[0].r}).toIntPt(),
-				v[3].mid.add(point{v[3].r, v[3].r}).toIntPt(),
-			}
-			gocv.Rectangle(&img, r, blue, 2)
+			gocv.Rectangle(&img, circlesRect(v), blue, 2)
 
-			gocv.Circle(&img, v[0].mid.toIntPt(), int(v[0].r), red, 2)
-			gocv.Circle(&img, v[1].mid.toIntPt(), int(v[1].r), green, 2)
-			gocv.Circle(&img, v[2].mid.toIntPt(), int(v[2].r), blue, 2)
-			gocv.Circle(&img, v[3].mid.toIntPt(), int(v[3].r), yellow, 2)
+			for i, c := range v {
+				gocv.Circle(&img, c.mid.toIntPt(), int(c.r), palette[i].RGB, 2)
+			}
 
 			// now we project around the whole A4 containing the calibration pattern
 			// a4 in cm: 21 x 29.7
 			a4hpx := (29.7 * pixPerCM) / 2.
 			a4wpx := (21.0 * pixPerCM) / 2.
-			midpoint := circlesMidpoint(v)
+			midpoint := calibrationCenter(v)
 			min := midpoint.add(point{-a4wpx, -a4hpx})
 			max := midpoint.add(point{a4wpx, a4hpx})
 			a4 := image.Rectangle{min.toIntPt(), max.toIntPt()}
 			gocv.Rectangle(&img, a4, blue, 4)
 
-			// adjust for displacement and display ratio
-			a4 = image.Rectangle{translate(min, displacement, displayRatio).toIntPt(), translate(max, displacement, displayRatio).toIntPt()}
-			gocv.Rectangle(&cimg, a4, blue, 4)
+			// map into beamerspace; under a homography the outline is no longer axis-aligned
+			outline := []point{min, {max.x, min.y}, max, {min.x, max.y}}
+			for i, p := range outline {
+				q := outline[(i+1)%4]
+				gocv.Line(&cimg, cResults.toBeamer(p).toIntPt(), cResults.toBeamer(q).toIntPt(), blue, 4)
+			}
 		}
 
-		gocv.Circle(&img, image.Pt(10, 10), 10, colorSamples[0], -1)
-		gocv.Circle(&img, image.Pt(30, 10), 10, colorSamples[1], -1)
-		gocv.Circle(&img, image.Pt(50, 10), 10, colorSamples[2], -1)
-		gocv.Circle(&img, image.Pt(70, 10), 10, colorSamples[3], -1)
+		for i, c := range colorSamples {
+			gocv.Circle(&img, image.Pt(10+20*i, 10), 10, c, -1)
+		}
 	}, colorSamples, 100); err != nil {
 		return calibrationResults{}
 	}
 
 	// TODO: happy (y/n) ? if no return to start of calibration
-	return calibrationResults{pixPerCM, displacement, displayRatio, colorSamples, scChsBrd}
+	return cResults
+}
+
+// straightScale is how much smaller straightened webcamspace is than beamerspace.
+// The same in both directions, so the beamer canvas fits in STRAIGHT_W x STRAIGHT_H without stretching
+func straightScale() float64 {
+	return math.Min(STRAIGHT_W/float64(beamerWidth), STRAIGHT_H/float64(beamerHeight))
+}
+
+// straightening maps the projected chessboard onto STRAIGHT_W x STRAIGHT_H,
+// so going from straightened webcamspace to beamerspace is mostly a matter of scaling up
+func straightToBeamer(p point) point {
+	return p.div(straightScale())
+}
+
+// toBeamer maps a point in straightened webcamspace to beamerspace.
+// Without a homography, displacement and displayRatio correct what straightening got wrong
+func (cr calibrationResults) toBeamer(p point) point {
+	if cr.homography != nil {
+		return cr.homography.apply(p)
+	}
+	return translate(straightToBeamer(p), cr.displacement, cr.displayRatio)
+}
+
+func (cr calibrationResults) colorClassifier() colorClassifier {
+	if len(cr.colorModels) == 0 {
+		return colorClassifierFromReference(cr.referenceColors)
+	}
+	return newColorClassifier(cr.colorModels)
+}
+
+var useHomography bool
+
+// UseHomographyCalibration replaces the second manual calibration step with
+// projecting a pattern of dots, solving a full camera to beamer homography
+func UseHomographyCalibration() {
+	useHomography = true
+}
+
+// structuredLightCalibration projects single dots on a grid in beamerspace one by one,
+// finds each in the straightened webcam image by differencing against a dark frame,
+// and solves for the homography from straightened webcamspace to beamerspace.
+// Pressing a key aborts.
+func structuredLightCalibration(fi frameInput, waitMillis int) (homography, error) {
+	// frames to wait after changing the projection, for beamer and webcam to catch up
+	const settleFrames = 10
+	// margin because the edges of the projection often fall outside of the webcam view
+	targets := []point{}
+	for x := 1; x < 6; x++ {
+		for y := 1; y < 4; y++ {
+			targets = append(targets, point{float64(x*beamerWidth) / 6., float64(y*beamerHeight) / 4.})
+		}
+	}
+
+	gray := gocv.NewMat()
+	defer gray.Close()
+	dark := gocv.NewMat()
+	defer dark.Close()
+	diff := gocv.NewMat()
+	defer diff.Close()
+
+	// show cimg for a few frames and keep a grayscale copy of the last one
+	capture := func() error {
+		for i := 0; i < settleFrames; i++ {
+			if ok := fi.webcam.Read(&fi.img); !ok {
+				return fmt.Errorf("cannot read device\n")
+			}
+			if fi.img.Empty() {
+				i--
+				continue
+			}
+			fi.debugWindow.Show(fi.img)
+			fi.projection.Show(fi.cimg)
+			if key := fi.keys.WaitKey(waitMillis); key >= 0 {
+				return fmt.Errorf("homography calibration aborted")
+			}
+		}
+		// find dots in straightened space, same as all other detection
+		straightImage := beamerToChessboard(fi.img, fi.scChsBrd)
+		gocv.CvtColor(straightImage, &gray, gocv.ColorBGRToGray)
+		straightImage.Close()
+		return nil
+	}
+
+	gocv.Rectangle(&fi.cimg, image.Rect(0, 0, beamerWidth, beamerHeight), colorBlack, -1)
+	if err := capture(); err != nil {
+		return nil, err
+	}
+	gray.CopyTo(&dark)
+
+	var src, dst []point
+	for _, t := range targets {
+		gocv.Rectangle(&fi.cimg, image.Rect(0, 0, beamerWidth, beamerHeight), colorBlack, -1)
+		gocv.Circle(&fi.cimg, t.toIntPt(), 10, colorWhite, -1)
+		if err := capture(); err != nil {
+			return nil, err
+		}
+		// the projected dot is whatever became a lot brighter than the dark frame
+		gocv.AbsDiff(gray, dark, &diff)
+		gocv.Threshold(diff, &diff, 50, 255, gocv.ThresholdBinary)
+		m := gocv.Moments(diff, true)
+		if m["m00"] < 10 {
+			// dot not seen by webcam, ie outside of its view
+			continue
+		}
+		src = append(src, point{m["m10"] / m["m00"], m["m01"] / m["m00"]})
+		dst = append(dst, t)
+	}
+	gocv.Rectangle(&fi.cimg, image.Rect(0, 0, beamerWidth, beamerHeight), colorBlack, -1)
+
+	if len(src) < 6 {
+		return nil, fmt.Errorf("found only %d of %d projected dots", len(src), len(targets))
+	}
+	return solveHomography(src, dst)
 }
 
 type straightChessboard struct {
@@ -247,7 +401,38 @@ type straightChessboard struct {
 	Roi         image.Rectangle
 	M           gocv.Mat
 	Csf         float64
-	ColorModels []gocv.Mat
+}
+
+// Close releases the mats of the calibration
+func (sc straightChessboard) Close() {
+	closeMats([]gocv.Mat{sc.Rotation, sc.Translation, sc.Camera, sc.Distortion, sc.MapX, sc.MapY, sc.M})
+}
+
+// MarshalJSON writes the format read by UnMarshalJSON
+func (sc straightChessboard) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Translation []float64
+		Rotation    []float64
+		Camera      []float64
+		Distortion  []float64
+		MapX        []float64
+		MapY        []float64
+		Maps        string
+		Roi         string
+		M           []float64
+		Csf         float64
+	}{
+		Translation: matToDoubleSlice64F(sc.Translation),
+		Rotation:    matToDoubleSlice64F(sc.Rotation),
+		Camera:      matToDoubleSlice64F(sc.Camera),
+		Distortion:  matToDoubleSlice64F(sc.Distortion),
+		MapX:        float32ToFloat64(matToFloatSlice32F(sc.MapX)),
+		MapY:        float32ToFloat64(matToFloatSlice32F(sc.MapY)),
+		Maps:        sizeToString(image.Pt(sc.MapX.Cols(), sc.MapX.Rows())),
+		Roi:         rectToString(sc.Roi),
+		M:           matToDoubleSlice64F(sc.M),
+		Csf:         sc.Csf,
+	})
 }
 
 func (sc *straightChessboard) UnMarshalJSON(data []byte) error {
@@ -259,10 +444,10 @@ func (sc *straightChessboard) UnMarshalJSON(data []byte) error {
 		Distortion  []float64
 		MapX        []float64
 		MapY        []float64
+		Maps        string
 		Roi         string
 		M           []float64
 		Csf         float64
-		ColorModels [][]float64
 		*Alias
 	}{
 		Alias: (*Alias)(sc),
@@ -272,34 +457,60 @@ func (sc *straightChessboard) UnMarshalJSON(data []byte) error {
 		return err
 	}
 
-	sc.Translation, _ = doubleSliceToMat64F(aux.Translation, 3, 1, 1)
-	sc.Rotation, _ = doubleSliceToMat64F(aux.Rotation, 3, 1, 1)
-	sc.Camera, _ = doubleSliceToMat64F(aux.Camera, 3, 3, 1)
-	sc.Distortion, _ = doubleSliceToMat64F(aux.Distortion, 5, 1, 1)
-	sc.MapX, _ = floatSliceToMat32F(aux.MapX, WEBCAM_HEIGHT, WEBCAM_WIDTH, 1)
-	sc.MapY, _ = floatSliceToMat32F(aux.MapY, WEBCAM_HEIGHT, WEBCAM_WIDTH, 1)
+	// the undistort maps are as big as the webcam frames they apply to; older files dont say
+	webcam := image.Pt(WEBCAM_WIDTH, WEBCAM_HEIGHT)
+	if aux.Maps != "" && stringToSize(aux.Maps) != webcam {
+		return fmt.Errorf("calibration.json was made at webcam resolution %s, expected %s: regenerate it with -chessboard", aux.Maps, sizeToString(webcam))
+	}
+	mats := []struct {
+		name       string
+		mat        *gocv.Mat
+		data       []float64
+		rows, cols int
+		toMat      func([]float64, int, int, int) (gocv.Mat, error)
+	}{
+		{"Translation", &sc.Translation, aux.Translation, 3, 1, doubleSliceToMat64F},
+		{"Rotation", &sc.Rotation, aux.Rotation, 3, 1, doubleSliceToMat64F},
+		{"Camera", &sc.Camera, aux.Camera, 3, 3, doubleSliceToMat64F},
+		{"Distortion", &sc.Distortion, aux.Distortion, 5, 1, doubleSliceToMat64F},
+		{"MapX", &sc.MapX, aux.MapX, webcam.Y, webcam.X, floatSliceToMat32F},
+		{"MapY", &sc.MapY, aux.MapY, webcam.Y, webcam.X, floatSliceToMat32F},
+		{"M", &sc.M, aux.M, 3, 3, doubleSliceToMat64F},
+	}
+	for i, m := range mats {
+		var err error
+		if len(m.data) != m.rows*m.cols {
+			err = fmt.Errorf("calibration.json: %s has %d values, expected %d", m.name, len(m.data), m.rows*m.cols)
+		} else {
+			*m.mat, err = m.toMat(m.data, m.rows, m.cols, 1)
+		}
+		if err != nil {
+			for _, made := range mats[:i] {
+				made.mat.Close()
+			}
+			return err
+		}
+	}
 	sc.Roi = stringToRect(aux.Roi)
-	sc.M, _ = doubleSliceToMat64F(aux.M, 3, 3, 1)
-	// sc.Csf = aux.Csf
-	// sizes := []int{HIST_SIZE, HIST_SIZE, HIST_SIZE}
-	// sc.ColorModels, _ = floatToMats32F(aux.ColorModels, sizes, NB_CLRD_CHCKRS)
-
+	sc.Csf = aux.Csf
+	if sc.Csf == 0 {
+		sc.Csf = defaultCsf
+	}
 	return nil
 }
 
-func loadCalibration(file string) straightChessboard {
+func loadCalibration(file string) (straightChessboard, error) {
 	b, err := os.ReadFile(file)
 	if err != nil {
-		fmt.Println(err)
+		return straightChessboard{}, err
 	}
 
 	scChsBrd := straightChessboard{}
-	err = scChsBrd.UnMarshalJSON(b)
-	if err != nil {
-		fmt.Println(err)
+	if err := scChsBrd.UnMarshalJSON(b); err != nil {
+		return straightChessboard{}, err
 	}
 
-	return scChsBrd
+	return scChsBrd, nil
 }
 
 // Helper function to convert image.Rectangle to string
@@ -0,0 +1,146 @@
+package talk
+
+import (
+	"encoding/json"
+	"image"
+	"reflect"
+	"testing"
+
+	"gocv.io/x/gocv"
+)
+
+func testMat64F(t *testing.T, rows, cols int, first float64) gocv.Mat {
+	t.Helper()
+	data := make([]float64, rows*cols)
+	for i := range data {
+		data[i] = first + float64(i)/4
+	}
+	m, err := doubleSliceToMat64F(data, rows, cols, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func testMat32F(t *testing.T, rows, cols int, first float64) gocv.Mat {
+	t.Helper()
+	data := make([]float64, rows*cols)
+	for i := range data {
+		data[i] = first + float64(i%1000)/4
+	}
+	m, err := floatSliceToMat32F(data, rows, cols, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func testChessboard(t *testing.T) straightChessboard {
+	return straightChessboard{
+		Rotation:    testMat64F(t, 3, 1, 0.1),
+		Translation: testMat64F(t, 3, 1, 10),
+		Camera:      testMat64F(t, 3, 3, 900),
+		Distortion:  testMat64F(t, 5, 1, -0.2),
+		MapX:        testMat32F(t, WEBCAM_HEIGHT, WEBCAM_WIDTH, 1),
+		MapY:        testMat32F(t, WEBCAM_HEIGHT, WEBCAM_WIDTH, 2),
+		Roi:         image.Rect(12, 34, 1200, 700),
+		M:           testMat64F(t, 3, 3, 1),
+		Csf:         0.35,
+	}
+}
+
+// savedChessboard is sc as in calibration.json, with fields changed as in edit
+func savedChessboard(t *testing.T, sc straightChessboard, edit map[string]any) []byte {
+	t.Helper()
+	b, err := sc.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(edit) == 0 {
+		return b
+	}
+	m := map[string]any{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range edit {
+		if v == nil {
+			delete(m, k)
+			continue
+		}
+		m[k] = v
+	}
+	if b, err = json.Marshal(m); err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestStraightChessboardRoundTrip(t *testing.T) {
+	want := testChessboard(t)
+	got := straightChessboard{}
+	if err := got.UnMarshalJSON(savedChessboard(t, want, nil)); err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range []struct {
+		name      string
+		got, want gocv.Mat
+	}{
+		{"Rotation", got.Rotation, want.Rotation},
+		{"Translation", got.Translation, want.Translation},
+		{"Camera", got.Camera, want.Camera},
+		{"Distortion", got.Distortion, want.Distortion},
+		{"M", got.M, want.M},
+	} {
+		if !reflect.DeepEqual(matToDoubleSlice64F(m.got), matToDoubleSlice64F(m.want)) {
+			t.Errorf("%s loaded as %v, saved %v", m.name, matToDoubleSlice64F(m.got), matToDoubleSlice64F(m.want))
+		}
+	}
+	for _, m := range []struct {
+		name      string
+		got, want gocv.Mat
+	}{
+		{"MapX", got.MapX, want.MapX},
+		{"MapY", got.MapY, want.MapY},
+	} {
+		if m.got.Rows() != WEBCAM_HEIGHT || m.got.Cols() != WEBCAM_WIDTH {
+			t.Errorf("%s loaded as %dx%d", m.name, m.got.Cols(), m.got.Rows())
+		}
+		if !reflect.DeepEqual(matToFloatSlice32F(m.got), matToFloatSlice32F(m.want)) {
+			t.Errorf("%s loaded with other values than saved", m.name)
+		}
+	}
+	if got.Roi != want.Roi || got.Csf != want.Csf {
+		t.Errorf("loaded roi %v csf %v, saved %v and %v", got.Roi, got.Csf, want.Roi, want.Csf)
+	}
+}
+
+func TestStraightChessboardDefaultsCsf(t *testing.T) {
+	sc := testChessboard(t)
+	for _, edit := range []map[string]any{{"Csf": nil}, {"Csf": 0}} {
+		got := straightChessboard{}
+		if err := got.UnMarshalJSON(savedChessboard(t, sc, edit)); err != nil {
+			t.Fatal(err)
+		}
+		if got.Csf != defaultCsf {
+			t.Errorf("with %v: loaded csf %v, want default %v", edit, got.Csf, defaultCsf)
+		}
+	}
+}
+
+func TestStraightChessboardRejectsOtherResolution(t *testing.T) {
+	sc := testChessboard(t)
+	for _, tt := range []struct {
+		name string
+		edit map[string]any
+	}{
+		{"maps made at another resolution", map[string]any{"Maps": "640x480"}},
+		{"map of the wrong size", map[string]any{"Maps": nil, "MapX": make([]float64, 640*480)}},
+		{"no camera matrix", map[string]any{"Camera": nil}},
+	} {
+		got := straightChessboard{}
+		if err := got.UnMarshalJSON(savedChessboard(t, sc, tt.edit)); err == nil {
+			t.Errorf("%s: loaded without error", tt.name)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package talk
+
+import "fmt"
+
+// Checked ids spend the two outer dots of each corner on parity over the inner three.
+// Read as symbols in a field with as many elements as the palette has colours,
+// a corner (ll, l, m, r, rr) is a codeword of a [5,3,3] code:
+//
+//	ll = l + m + r
+//	rr = l + 2*m + 3*r
+//
+// so two different corners always differ in at least 3 dots. addToDB then only accepts pages
+// at least checkedMinDistance dots away from all others, as seen from any 3 corners, and
+// lookupPage decodes to the nearest registered page. This corrects up to 2 misread dots,
+// or 4 unknown ones, in the 15 dots of the 3 corners a page is recognised by.
+//
+// The field is GF(4) for a palette of 4 colours, where 2 and 3 are w and w^2, or the
+// integers modulo 5 or 7. Other palette sizes have no such code, and cant use checked ids.
+
+// minimum hamming distance between registered page views, when using checked ids
+const checkedMinDistance = 5
+
+// multiplication in GF(4), with 2 = w and 3 = w^2; addition is xor
+var gf4Mul = [4][4]uint8{
+	{0, 0, 0, 0},
+	{0, 1, 2, 3},
+	{0, 2, 3, 1},
+	{0, 3, 1, 2},
+}
+
+func checkedIDsSupported() error {
+	switch len(palette) {
+	case 4, 5, 7:
+		return nil
+	}
+	return fmt.Errorf("checked ids need a palette of 4, 5 or 7 colours, not %d", len(palette))
+}
+
+func fieldAdd(a, b uint8) uint8 {
+	if len(palette) == 4 {
+		return a ^ b
+	}
+	return (a + b) % uint8(len(palette))
+}
+
+func fieldMul(a, b uint8) uint8 {
+	if len(palette) == 4 {
+		return gf4Mul[a][b]
+	}
+	return (a * b) % uint8(len(palette))
+}
+
+// checkedCorner returns the corner with data dots l, m and r and its parity dots filled in
+func checkedCorner(l, m, r dotColor) corner {
+	n := dotColor(len(palette))
+	if l >= n || m >= n || r >= n {
+		return corner{ll: dot{c: unknownDot}, l: dot{c: l}, m: dot{c: m}, r: dot{c: r}, rr: dot{c: unknownDot}}
+	}
+	a, b, c := uint8(l), uint8(m), uint8(r)
+	return corner{
+		ll: dot{c: dotColor(fieldAdd(fieldAdd(a, b), c))},
+		l:  dot{c: l},
+		m:  dot{c: m},
+		r:  dot{c: r},
+		rr: dot{c: dotColor(fieldAdd(fieldAdd(a, fieldMul(2, b)), fieldMul(3, c)))},
+	}
+}
+
+// checked reports whether the parity dots of c match its data dots
+func (c corner) checked() bool {
+	want := checkedCorner(c.l.c, c.m.c, c.r.c)
+	return want.ll.c != unknownDot && c.ll.c == want.ll.c && c.rr.c == want.rr.c
+}
+
+// idDots are the colours of the dots of c that identify it under the current id scheme
+func (c corner) idDots() []dotColor {
+	if ids == simpleIDScheme {
+		return []dotColor{c.l.c, c.m.c, c.r.c}
+	}
+	return []dotColor{c.ll.c, c.l.c, c.m.c, c.r.c, c.rr.c}
+}
+
+// viewDistance counts the dots in which two views from the same number of corners differ.
+// Dots we couldnt classify in seen are counted as erasures instead
+func viewDistance(seen, registered []corner) (errors, erasures int) {
+	for i := range seen {
+		s, r := seen[i].idDots(), registered[i].idDots()
+		for j := range s {
+			switch {
+			case s[j] == unknownDot:
+				erasures++
+			case s[j] != r[j]:
+				errors++
+			}
+		}
+	}
+	return errors, erasures
+}
+
+// minViewDistance is how many dots registered page views have to differ in
+func minViewDistance() int {
+	if ids == checkedIDScheme {
+		return checkedMinDistance
+	}
+	return 1
+}
@@ -0,0 +1,165 @@
+package talk
+
+import "testing"
+
+// useIDs starts t with an empty page db, the default palette and id scheme s
+func useIDs(t *testing.T, s idScheme) {
+	oldIDs, oldPalette, oldTwoCorner := ids, palette, twoCornerIDs
+	oldDB, oldAdjacent, oldDiagonal := pageDB, adjacentDB, diagonalDB
+	t.Cleanup(func() {
+		ids, palette, twoCornerIDs = oldIDs, oldPalette, oldTwoCorner
+		pageDB, adjacentDB, diagonalDB = oldDB, oldAdjacent, oldDiagonal
+	})
+	ids, palette, twoCornerIDs = s, DefaultPalette, false
+	pageDB, adjacentDB, diagonalDB = map[pageKey]pageView{}, map[pageKey]pageView{}, map[pageKey]pageView{}
+}
+
+// misread changes the colour of dot d (0 is ll) of corner c to another palette colour
+func misread(c corner, d int) corner {
+	dots := []*dot{&c.ll, &c.l, &c.m, &c.r, &c.rr}
+	dots[d].c = (dots[d].c + 1) % dotColor(len(palette))
+	return c
+}
+
+// erase makes dot d (0 is ll) of corner c unreadable
+func erase(c corner, d int) corner {
+	dots := []*dot{&c.ll, &c.l, &c.m, &c.r, &c.rr}
+	dots[d].c = unknownDot
+	return c
+}
+
+func TestCheckedIDsDecode(t *testing.T) {
+	useIDs(t, checkedIDScheme)
+	if !AddPageFromShorthand("rgb", "gyb", "byr", "ygr", "") {
+		t.Fatal("page not registered")
+	}
+	var printed []corner
+	var want uint64
+	for _, v := range pageDB {
+		if v.first == 0 {
+			printed, want = v.corners, v.page.id
+		}
+	}
+
+	// a dot is given as corner, dot within the corner: ulhc, urhc and lrhc are corners 0 to 2
+	for _, tt := range []struct {
+		name            string
+		wrong, erasures [][2]int
+		ok              bool
+	}{
+		{name: "as printed", ok: true},
+		{name: "one wrong dot", wrong: [][2]int{{1, 2}}, ok: true},
+		{name: "two wrong dots in one corner", wrong: [][2]int{{0, 0}, {0, 3}}, ok: true},
+		{name: "two wrong dots in two corners", wrong: [][2]int{{0, 2}, {2, 4}}, ok: true},
+		{name: "four erasures", erasures: [][2]int{{0, 0}, {1, 1}, {1, 2}, {2, 4}}, ok: true},
+		{name: "four erasures in one corner", erasures: [][2]int{{1, 0}, {1, 1}, {1, 2}, {1, 3}}, ok: true},
+		{name: "one wrong dot and two erasures", wrong: [][2]int{{2, 1}}, erasures: [][2]int{{0, 2}, {1, 4}}, ok: true},
+		{name: "three wrong dots", wrong: [][2]int{{0, 1}, {1, 1}, {2, 1}}, ok: false},
+		{name: "five erasures", erasures: [][2]int{{0, 0}, {0, 1}, {1, 2}, {2, 3}, {2, 4}}, ok: false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			seen := append([]corner{}, printed...)
+			for _, d := range tt.wrong {
+				seen[d[0]] = misread(seen[d[0]], d[1])
+			}
+			for _, d := range tt.erasures {
+				seen[d[0]] = erase(seen[d[0]], d[1])
+			}
+			v, ok := lookupPage(seen)
+			if ok != tt.ok {
+				t.Fatalf("recognised: %v, want %v", ok, tt.ok)
+			}
+			if ok && v.page.id != want {
+				t.Errorf("recognised page %d, want %d", v.page.id, want)
+			}
+		})
+	}
+}
+
+func TestCheckedIDsAddToDB(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		pages [][4]string
+		want  []bool
+	}{
+		{
+			name:  "far enough apart",
+			pages: [][4]string{{"rgb", "gyb", "byr", "ygr"}, {"rrr", "bbb", "ggg", "yyy"}},
+			want:  []bool{true, true},
+		},
+		{
+			name:  "one data dot apart",
+			pages: [][4]string{{"rgb", "gyb", "byr", "ygr"}, {"rgb", "gyb", "byr", "yyr"}},
+			want:  []bool{true, false},
+		},
+		{
+			name:  "one corner apart",
+			pages: [][4]string{{"rgb", "gyb", "byr", "ygr"}, {"yrg", "gyb", "byr", "ygr"}},
+			want:  []bool{true, false},
+		},
+		{
+			name:  "same page turned",
+			pages: [][4]string{{"rgb", "gyb", "byr", "ygr"}, {"gyb", "byr", "ygr", "rgb"}},
+			want:  []bool{true, false},
+		},
+		{
+			name:  "views of its own page too close",
+			pages: [][4]string{{"rgb", "rgb", "rgb", "rgb"}},
+			want:  []bool{false},
+		},
+		{
+			name:  "parity dots wrong",
+			pages: [][4]string{{"rrgbr", "gyb", "byr", "ygr"}},
+			want:  []bool{false},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			useIDs(t, checkedIDScheme)
+			for i, p := range tt.pages {
+				if got := AddPageFromShorthand(p[0], p[1], p[2], p[3], ""); got != tt.want[i] {
+					t.Errorf("page %v registered: %v, want %v", p, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+// oldPartialID is how partial ids were made before checked ids, with simplified ids
+func oldPartialID(x, y, z uint16) uint64 {
+	return uint64(x) | uint64(y)<<6 | uint64(z)<<12
+}
+
+// oldPageID is how page ids were made before checked ids, with simplified ids
+func oldPageID(ulhc, urhc, lrhc, llhc uint16) uint64 {
+	return uint64(llhc) | uint64(lrhc)<<6 | uint64(urhc)<<12 | uint64(ulhc)<<18
+}
+
+func TestSimplifiedIDsKeepOldIDs(t *testing.T) {
+	for _, p := range [][4]string{
+		{"rgbyr", "ggbyg", "ybrgb", "rrrry"},
+		{"yyyyy", "bgrgb", "rbgyy", "gyrbg"},
+	} {
+		useIDs(t, simpleIDScheme)
+		if !AddPageFromShorthand(p[0], p[1], p[2], p[3], "") {
+			t.Fatalf("page %v not registered", p)
+		}
+		var cs [4]uint16
+		for i, s := range p {
+			cs[i] = cornerShorthand(s).id()
+		}
+		for k := 0; k < 4; k++ {
+			id := oldPartialID(cs[k], cs[(k+1)%4], cs[(k+2)%4])
+			v, ok := pageDB[pageKey{fiducial: dotFiducial, id: id}]
+			if !ok {
+				t.Errorf("page %v has no view under old partial id %d", p, id)
+				continue
+			}
+			if v.first != k {
+				t.Errorf("page %v old partial id %d is the view from corner %d, want %d", p, id, v.first, k)
+			}
+			if want := oldPageID(cs[0], cs[1], cs[2], cs[3]); v.page.id != want {
+				t.Errorf("page %v has id %d, want old id %d", p, v.page.id, want)
+			}
+		}
+	}
+}
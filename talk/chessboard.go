@@ -0,0 +1,289 @@
+package talk
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"os"
+
+	"gocv.io/x/gocv"
+)
+
+// inner corners of the printed chessboard used for camera intrinsics
+const CHESSBOARD_COLS = 9
+const CHESSBOARD_ROWS = 6
+
+// number of views of the printed chessboard to collect before calibrating
+const CHESSBOARD_VIEWS = 12
+
+const keyEscape = 27
+
+var forceChessboard bool
+
+// ForceChessboardCalibration regenerates calibration.json on startup, even if it exists
+func ForceChessboardCalibration() {
+	forceChessboard = true
+}
+
+func saveCalibration(file string, sc straightChessboard) error {
+	b, err := sc.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, b, 0644)
+}
+
+// chessboardCalibration generates what loadCalibration reads from calibration.json.
+// First we collect views of a printed chessboard held at different angles to find the
+// camera intrinsics and distortion, from which we get the undistort maps.
+// Then the beamer projects a chessboard filling its canvas: finding that in the undistorted
+// image gives the roi and perspective matrix that straighten webcam frames into beamerspace,
+// scaled down to STRAIGHT_W x STRAIGHT_H.
+// Any key captures a view or confirms the projected board; escape aborts.
+func chessboardCalibration(webcam FrameSource, debugwindow, projection RenderSink, keys KeySource) (straightChessboard, error) {
+	img := gocv.NewMat()
+	defer img.Close()
+	gray := gocv.NewMat()
+	defer gray.Close()
+	corners := gocv.NewMat()
+	defer corners.Close()
+	cimg := gocv.NewMatWithSize(beamerHeight, beamerWidth, gocv.MatTypeCV8UC3)
+	defer cimg.Close()
+
+	patternSize := image.Pt(CHESSBOARD_COLS, CHESSBOARD_ROWS)
+	flags := gocv.CalibCBAdaptiveThresh | gocv.CalibCBNormalizeImage
+
+	// object points are the same for each view: the chessboard grid in units of one square
+	objPts := []gocv.Point3f{}
+	for y := 0; y < CHESSBOARD_ROWS; y++ {
+		for x := 0; x < CHESSBOARD_COLS; x++ {
+			objPts = append(objPts, gocv.Point3f{X: float32(x), Y: float32(y)})
+		}
+	}
+	objectPoints := gocv.NewPoints3fVector()
+	defer objectPoints.Close()
+	imagePoints := gocv.NewPoints2fVector()
+	defer imagePoints.Close()
+
+	w, h := beamerWidth/2., beamerHeight/2.
+	gocv.Rectangle(&cimg, image.Rect(0, 0, beamerWidth, beamerHeight), colorBlack, -1)
+	gocv.PutText(&cimg, "Hold printed chessboard in view at different angles", image.Pt(w-200, h), 0, .5, colorWhite, 2)
+
+	// Step 1: collect chessboard views
+	views := 0
+	for views < CHESSBOARD_VIEWS {
+		if ok := webcam.Read(&img); !ok {
+			return straightChessboard{}, fmt.Errorf("cannot read device\n")
+		}
+		if img.Empty() {
+			continue
+		}
+		if img.Cols() != WEBCAM_WIDTH || img.Rows() != WEBCAM_HEIGHT {
+			return straightChessboard{}, fmt.Errorf("webcam resolution %dx%d, calibration.json expects %dx%d", img.Cols(), img.Rows(), WEBCAM_WIDTH, WEBCAM_HEIGHT)
+		}
+		gocv.CvtColor(img, &gray, gocv.ColorBGRToGray)
+		found := gocv.FindChessboardCorners(gray, patternSize, &corners, flags)
+		gocv.DrawChessboardCorners(&img, patternSize, corners, found)
+		gocv.PutText(&img, fmt.Sprintf("views: %d/%d", views, CHESSBOARD_VIEWS), image.Pt(0, 20), 0, .5, colorGreen, 2)
+
+		debugwindow.Show(img)
+		projection.Show(cimg)
+		key := keys.WaitKey(100)
+		if key == keyEscape {
+			return straightChessboard{}, fmt.Errorf("chessboard calibration aborted")
+		}
+		if key < 0 || !found {
+			continue
+		}
+		objPtsVec := gocv.NewPoint3fVectorFromPoints(objPts)
+		imgPtsVec := gocv.NewPoint2fVectorFromMat(corners)
+		objectPoints.Append(objPtsVec)
+		imagePoints.Append(imgPtsVec)
+		objPtsVec.Close()
+		imgPtsVec.Close()
+		views++
+	}
+
+	// Step 2: camera intrinsics and undistort maps
+	imageSize := image.Pt(WEBCAM_WIDTH, WEBCAM_HEIGHT)
+	camera := gocv.NewMat()
+	distortion := gocv.NewMat()
+	rvecs := gocv.NewMat()
+	defer rvecs.Close()
+	tvecs := gocv.NewMat()
+	defer tvecs.Close()
+	rms := gocv.CalibrateCamera(objectPoints, imagePoints, imageSize, &camera, &distortion, &rvecs, &tvecs, gocv.CalibFlagDefault)
+	fmt.Println("chessboard calibration reprojection error:", rms)
+
+	newCamera, _ := gocv.GetOptimalNewCameraMatrixWithParams(camera, distortion, imageSize, 1, imageSize, false)
+	defer newCamera.Close()
+	noRotation := gocv.NewMat()
+	defer noRotation.Close()
+	mapX := gocv.NewMat()
+	mapY := gocv.NewMat()
+	gocv.InitUndistortRectifyMap(camera, distortion, noRotation, newCamera, imageSize, int(gocv.MatTypeCV32F), mapX, mapY)
+
+	// rvecs and tvecs have one 3-channel row per view: keep the average pose of the board
+	rvec, tvec := meanPose(matToDoubleSlice64F(rvecs), matToDoubleSlice64F(tvecs))
+	rotation, _ := doubleSliceToMat64F(rvec, 3, 1, 1)
+	translation, _ := doubleSliceToMat64F(tvec, 3, 1, 1)
+
+	// Step 3: project a chessboard filling the beamer and straighten it
+	square := min(beamerWidth/(CHESSBOARD_COLS+3), beamerHeight/(CHESSBOARD_ROWS+3))
+	origin := image.Pt((beamerWidth-(CHESSBOARD_COLS+1)*square)/2, (beamerHeight-(CHESSBOARD_ROWS+1)*square)/2)
+	gocv.Rectangle(&cimg, image.Rect(0, 0, beamerWidth, beamerHeight), colorWhite, -1)
+	for y := 0; y < CHESSBOARD_ROWS+1; y++ {
+		for x := 0; x < CHESSBOARD_COLS+1; x++ {
+			if (x+y)%2 == 1 {
+				continue
+			}
+			sq := image.Rect(x*square, y*square, (x+1)*square, (y+1)*square).Add(origin)
+			gocv.Rectangle(&cimg, sq, colorBlack, -1)
+		}
+	}
+	// inner corners of the projected board in beamerspace, clockwise from upper left like outerCorners
+	beamerCorners := [4]point{
+		{float64(origin.X + square), float64(origin.Y + square)},
+		{float64(origin.X + CHESSBOARD_COLS*square), float64(origin.Y + square)},
+		{float64(origin.X + CHESSBOARD_COLS*square), float64(origin.Y + CHESSBOARD_ROWS*square)},
+		{float64(origin.X + square), float64(origin.Y + CHESSBOARD_ROWS*square)},
+	}
+
+	undistorted := gocv.NewMat()
+	defer undistorted.Close()
+	var roi image.Rectangle
+	var m gocv.Mat
+	for {
+		if ok := webcam.Read(&img); !ok {
+			return straightChessboard{}, fmt.Errorf("cannot read device\n")
+		}
+		if img.Empty() {
+			continue
+		}
+		gocv.Remap(img, &undistorted, mapX, mapY, gocv.InterpolationLinear, gocv.BorderConstant, colorBlack)
+		gocv.CvtColor(undistorted, &gray, gocv.ColorBGRToGray)
+		found := gocv.FindChessboardCorners(gray, patternSize, &corners, flags)
+		gocv.DrawChessboardCorners(&undistorted, patternSize, corners, found)
+
+		debugwindow.Show(undistorted)
+		projection.Show(cimg)
+		key := keys.WaitKey(100)
+		if key == keyEscape {
+			return straightChessboard{}, fmt.Errorf("chessboard calibration aborted")
+		}
+		if key < 0 || !found {
+			continue
+		}
+
+		cv := gocv.NewPoint2fVectorFromMat(corners)
+		pts := cv.ToPoints()
+		cv.Close()
+		outer, ok := outerCorners(pts)
+		if !ok {
+			fmt.Println("projected chessboard seen mirrored, check the webcam is not flipped")
+			continue
+		}
+
+		// roi is the bounding box of the whole projection, extrapolated from the inner corners
+		toWebcam, err := solveHomography(beamerCorners[:], outer)
+		if err != nil {
+			return straightChessboard{}, err
+		}
+		bounds := []point{
+			toWebcam.apply(point{0, 0}),
+			toWebcam.apply(point{float64(beamerWidth), 0}),
+			toWebcam.apply(point{float64(beamerWidth), float64(beamerHeight)}),
+			toWebcam.apply(point{0, float64(beamerHeight)}),
+		}
+		roi = ptsToRect(bounds).Intersect(image.Rect(0, 0, WEBCAM_WIDTH, WEBCAM_HEIGHT))
+
+		// M maps roi-relative webcam coordinates onto the scaled down beamer canvas
+		src := make([]gocv.Point2f, 4)
+		dst := make([]gocv.Point2f, 4)
+		for i := range outer {
+			src[i] = gocv.Point2f{X: float32(outer[i].x) - float32(roi.Min.X), Y: float32(outer[i].y) - float32(roi.Min.Y)}
+			dst[i] = gocv.Point2f{X: float32(beamerCorners[i].x * straightScale()), Y: float32(beamerCorners[i].y * straightScale())}
+		}
+		srcVec := gocv.NewPoint2fVectorFromPoints(src)
+		dstVec := gocv.NewPoint2fVectorFromPoints(dst)
+		m = gocv.GetPerspectiveTransform2f(srcVec, dstVec)
+		srcVec.Close()
+		dstVec.Close()
+		break
+	}
+
+	return straightChessboard{
+		Rotation:    rotation,
+		Translation: translation,
+		Camera:      camera,
+		Distortion:  distortion,
+		MapX:        mapX,
+		MapY:        mapY,
+		Roi:         roi,
+		M:           m,
+	}, nil
+}
+
+// outerCorners picks the 4 outer inner corners, clockwise from upper left, out of the corners
+// FindChessboardCorners found, which are row by row but might start from either end of the board.
+// A board seen mirrored is never clockwise, so it is not ok
+func outerCorners(pts []gocv.Point2f) ([]point, bool) {
+	n := len(pts)
+	idx := []int{0, CHESSBOARD_COLS - 1, n - 1, n - CHESSBOARD_COLS}
+	first, last := pts[0], pts[n-1]
+	if first.X+first.Y > last.X+last.Y {
+		// board upside down
+		idx = []int{n - 1, n - CHESSBOARD_COLS, 0, CHESSBOARD_COLS - 1}
+	}
+	outer := make([]point, 4)
+	for i, j := range idx {
+		outer[i] = point{float64(pts[j].X), float64(pts[j].Y)}
+	}
+	right, down := outer[1].sub(outer[0]), outer[3].sub(outer[0])
+	// y points down, so clockwise is a positive cross product
+	return outer, right.x*down.y-right.y*down.x > 0
+}
+
+// meanPose averages rotation vectors as quaternions and translation vectors as they are,
+// given as concatenated 3-vectors, one per view
+func meanPose(rvecs, tvecs []float64) ([]float64, []float64) {
+	var q [4]float64
+	for i := 0; i+3 <= len(rvecs); i += 3 {
+		vi := quaternion(rvecs[i : i+3])
+		// q and -q are the same rotation: add up those on the same side
+		if q[0]*vi[0]+q[1]*vi[1]+q[2]*vi[2]+q[3]*vi[3] < 0 {
+			for j := range vi {
+				vi[j] = -vi[j]
+			}
+		}
+		for j := range q {
+			q[j] += vi[j]
+		}
+	}
+	t := []float64{0, 0, 0}
+	views := len(tvecs) / 3
+	for i := 0; i < 3*views; i++ {
+		t[i%3] += tvecs[i] / float64(views)
+	}
+	norm := math.Sqrt(q[0]*q[0] + q[1]*q[1] + q[2]*q[2] + q[3]*q[3])
+	if norm == 0 {
+		return []float64{0, 0, 0}, t
+	}
+	w := q[0] / norm
+	s := math.Sqrt(1 - math.Min(1, w*w))
+	if s < EPSILON {
+		return []float64{0, 0, 0}, t
+	}
+	angle := 2 * math.Acos(math.Max(-1, math.Min(1, w)))
+	return []float64{q[1] / norm / s * angle, q[2] / norm / s * angle, q[3] / norm / s * angle}, t
+}
+
+// quaternion of the rotation around r by |r| radians
+func quaternion(r []float64) [4]float64 {
+	angle := math.Sqrt(r[0]*r[0] + r[1]*r[1] + r[2]*r[2])
+	if angle < EPSILON {
+		return [4]float64{1, 0, 0, 0}
+	}
+	s := math.Sin(angle/2) / angle
+	return [4]float64{math.Cos(angle / 2), r[0] * s, r[1] * s, r[2] * s}
+}
@@ -0,0 +1,63 @@
+package talk
+
+import (
+	"math"
+	"testing"
+
+	"gocv.io/x/gocv"
+)
+
+// inner corners as FindChessboardCorners reports them, row by row from (x0, y0)
+func chessboardGrid(x0, y0, dx, dy float32) []gocv.Point2f {
+	pts := []gocv.Point2f{}
+	for y := 0; y < CHESSBOARD_ROWS; y++ {
+		for x := 0; x < CHESSBOARD_COLS; x++ {
+			pts = append(pts, gocv.Point2f{X: x0 + float32(x)*dx, Y: y0 + float32(y)*dy})
+		}
+	}
+	return pts
+}
+
+func TestOuterCorners(t *testing.T) {
+	want := []point{{10, 20}, {90, 20}, {90, 70}, {10, 70}}
+	for _, tt := range []struct {
+		name string
+		pts  []gocv.Point2f
+		ok   bool
+	}{
+		{"upright", chessboardGrid(10, 20, 10, 10), true},
+		{"upside down", chessboardGrid(90, 70, -10, -10), true},
+		{"mirrored", chessboardGrid(90, 20, -10, 10), false},
+	} {
+		outer, ok := outerCorners(tt.pts)
+		if ok != tt.ok {
+			t.Errorf("%s: got ok %v, want %v", tt.name, ok, tt.ok)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		for i := range want {
+			if outer[i] != want[i] {
+				t.Errorf("%s: got %v, want %v", tt.name, outer, want)
+				break
+			}
+		}
+	}
+}
+
+func TestMeanPose(t *testing.T) {
+	// rotations around z by 0.1 and 0.3 average to 0.2, also when one is given the long way round
+	for _, rvecs := range [][]float64{
+		{0, 0, 0.1, 0, 0, 0.3},
+		{0, 0, 0.1, 0, 0, 0.3 - 2*math.Pi},
+	} {
+		r, tr := meanPose(rvecs, []float64{1, 2, 3, 3, 4, 5})
+		if math.Abs(r[0]) > 1e-9 || math.Abs(r[1]) > 1e-9 || math.Abs(r[2]-0.2) > 1e-9 {
+			t.Errorf("mean of %v is %v, want [0 0 0.2]", rvecs, r)
+		}
+		if tr[0] != 2 || tr[1] != 3 || tr[2] != 4 {
+			t.Errorf("mean translation %v, want [2 3 4]", tr)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package talk
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// lab is a colour in CIELAB space (D65 white point), where euclidian distance
+// is a lot closer to perceived difference than in RGB
+type lab struct {
+	l, a, b float64
+}
+
+func toLab(c color.Color) lab {
+	rr, gg, bb, _ := c.RGBA()
+	// sRGB to linear RGB
+	linear := func(v uint32) float64 {
+		f := float64(v>>8) / 255.
+		if f <= 0.04045 {
+			return f / 12.92
+		}
+		return math.Pow((f+0.055)/1.055, 2.4)
+	}
+	r, g, b := linear(rr), linear(gg), linear(bb)
+	// linear RGB to XYZ, normalised by the D65 reference white
+	x := (0.4124*r + 0.3576*g + 0.1805*b) / 0.95047
+	y := (0.2126*r + 0.7152*g + 0.0722*b) / 1.00000
+	z := (0.0193*r + 0.1192*g + 0.9505*b) / 1.08883
+	f := func(t float64) float64 {
+		if t > 0.008856 {
+			return math.Cbrt(t)
+		}
+		return 7.787*t + 16./116.
+	}
+	fx, fy, fz := f(x), f(y), f(z)
+	return lab{116*fy - 16, 500 * (fx - fy), 200 * (fy - fz)}
+}
+
+// only sample the inner part of a dot, its edge blurs into the paper
+const dotSampleRadius = 0.6
+
+// sampleDot returns the colours of all pixels in the inner part of a dot
+func sampleDot(img image.Image, mid point, r float64) []lab {
+	rr := r * dotSampleRadius
+	if rr < 1 {
+		rr = 1
+	}
+	samples := []lab{}
+	bounds := img.Bounds()
+	for y := int(mid.y - rr); y <= int(mid.y+rr); y++ {
+		for x := int(mid.x - rr); x <= int(mid.x+rr); x++ {
+			if !image.Pt(x, y).In(bounds) {
+				continue
+			}
+			if euclidian(point{float64(x), float64(y)}.sub(mid)) > rr {
+				continue
+			}
+			samples = append(samples, toLab(img.At(x, y)))
+		}
+	}
+	return samples
+}
+
+// averageColor averages RGB over the inner part of a dot instead of taking only its center pixel
+func averageColor(img image.Image, mid point, r float64) color.RGBA {
+	rr := r * dotSampleRadius
+	if rr < 1 {
+		rr = 1
+	}
+	var sr, sg, sb, n uint32
+	bounds := img.Bounds()
+	for y := int(mid.y - rr); y <= int(mid.y+rr); y++ {
+		for x := int(mid.x - rr); x <= int(mid.x+rr); x++ {
+			if !image.Pt(x, y).In(bounds) {
+				continue
+			}
+			if euclidian(point{float64(x), float64(y)}.sub(mid)) > rr {
+				continue
+			}
+			cr, cg, cb, _ := img.At(x, y).RGBA()
+			sr, sg, sb = sr+cr>>8, sg+cg>>8, sb+cb>>8
+			n++
+		}
+	}
+	if n == 0 {
+		cr, cg, cb, _ := img.At(int(mid.x), int(mid.y)).RGBA()
+		return color.RGBA{uint8(cr >> 8), uint8(cg >> 8), uint8(cb >> 8), 0}
+	}
+	return color.RGBA{uint8(sr / n), uint8(sg / n), uint8(sb / n), 0}
+}
+
+// colorModel is a gaussian over lab space with a diagonal covariance
+type colorModel struct {
+	mean, variance lab
+}
+
+// variance floor, so a model learned from very uniform samples doesnt reject everything
+const minColorVariance = 9.0
+
+// used for models without learned variance, i.e. from reference colours only
+const defaultColorVariance = 100.0
+
+// learnColorModel fits a model to samples of a dot. Without any, like for a dot lost in every
+// sample frame, it falls back to the reference colour ref
+func learnColorModel(samples []lab, ref color.Color) colorModel {
+	if len(samples) == 0 {
+		return referenceColorModel(ref)
+	}
+	var mean lab
+	for _, s := range samples {
+		mean = lab{mean.l + s.l, mean.a + s.a, mean.b + s.b}
+	}
+	n := float64(len(samples))
+	mean = lab{mean.l / n, mean.a / n, mean.b / n}
+	var variance lab
+	for _, s := range samples {
+		dl, da, db := s.l-mean.l, s.a-mean.a, s.b-mean.b
+		variance = lab{variance.l + dl*dl, variance.a + da*da, variance.b + db*db}
+	}
+	variance = lab{
+		math.Max(variance.l/n, minColorVariance),
+		math.Max(variance.a/n, minColorVariance),
+		math.Max(variance.b/n, minColorVariance),
+	}
+	return colorModel{mean: mean, variance: variance}
+}
+
+// mahalanobis distance of c to the model, in standard deviations
+func (m colorModel) distance(c lab) float64 {
+	dl, da, db := c.l-m.mean.l, c.a-m.mean.a, c.b-m.mean.b
+	return math.Sqrt(dl*dl/m.variance.l + da*da/m.variance.a + db*db/m.variance.b)
+}
+
+// colorClassifier labels dots with one of the dotColors, or unknownDot if it isnt confident
+type colorClassifier struct {
+	// indexed by dotColor
+	models []colorModel
+	// dots further than this many standard deviations from any model are unknown
+	maxDistance float64
+	// dots with lower confidence than this are unknown
+	minConfidence float64
+}
+
+func newColorClassifier(models []colorModel) colorClassifier {
+	return colorClassifier{
+		models:        models,
+		maxDistance:   4.0,
+		minConfidence: 0.8,
+	}
+}
+
+// colorClassifierFromReference is a fallback when no models were learned during calibration
+func colorClassifierFromReference(ref []color.RGBA) colorClassifier {
+	models := make([]colorModel, len(ref))
+	for i, c := range ref {
+		models[i] = referenceColorModel(c)
+	}
+	return newColorClassifier(models)
+}
+
+func referenceColorModel(c color.Color) colorModel {
+	v := defaultColorVariance
+	return colorModel{mean: toLab(c), variance: lab{v, v, v}}
+}
+
+// classify returns the most likely dotColor for c and a confidence in [0,1]:
+// the likelihood of the best model relative to all models combined
+func (cc colorClassifier) classify(c color.Color) (dotColor, float64) {
+	if len(cc.models) == 0 {
+		return unknownDot, 0
+	}
+	x := toLab(c)
+	best, bestDist := 0, math.MaxFloat64
+	var total, bestLikelihood float64
+	for i, m := range cc.models {
+		d := m.distance(x)
+		likelihood := math.Exp(-0.5 * d * d)
+		total += likelihood
+		if d < bestDist {
+			best, bestDist, bestLikelihood = i, d, likelihood
+		}
+	}
+	if bestDist > cc.maxDistance || total == 0 {
+		return unknownDot, 0
+	}
+	confidence := bestLikelihood / total
+	if confidence < cc.minConfidence {
+		return unknownDot, confidence
+	}
+	return dotColor(best), confidence
+}
+
+// classifyCircle prefers back projected histogram probabilities over the sampled colour:
+// once calibration learned histograms, the colour models are not used at all
+func (cc colorClassifier) classifyCircle(c circle) (dotColor, float64) {
+	if c.probs != nil {
+		return classifyProbabilities(c.probs, cc.minConfidence)
+	}
+	return cc.classify(c.c)
+}
@@ -0,0 +1,94 @@
+package talk
+
+import (
+	"image/color"
+	"math"
+	"testing"
+)
+
+func TestToLab(t *testing.T) {
+	for _, tt := range []struct {
+		c    color.RGBA
+		want lab
+	}{
+		{color.RGBA{255, 255, 255, 255}, lab{100, 0, 0}},
+		{color.RGBA{0, 0, 0, 255}, lab{0, 0, 0}},
+		{color.RGBA{128, 128, 128, 255}, lab{53.59, 0, 0}},
+		{color.RGBA{255, 0, 0, 255}, lab{53.24, 80.09, 67.20}},
+		{color.RGBA{0, 255, 0, 255}, lab{87.73, -86.18, 83.18}},
+		{color.RGBA{0, 0, 255, 255}, lab{32.30, 79.19, -107.86}},
+		{color.RGBA{255, 255, 0, 255}, lab{97.14, -21.55, 94.48}},
+	} {
+		got := toLab(tt.c)
+		if math.Abs(got.l-tt.want.l) > 0.2 || math.Abs(got.a-tt.want.a) > 0.2 || math.Abs(got.b-tt.want.b) > 0.2 {
+			t.Errorf("toLab(%v) = %.2f, want %.2f", tt.c, got, tt.want)
+		}
+	}
+}
+
+func TestLearnColorModel(t *testing.T) {
+	m := learnColorModel([]lab{{40, 10, -10}, {60, 30, -30}, {50, 20, -20}, {50, 20, -20}}, color.RGBA{})
+	if m.mean != (lab{50, 20, -20}) {
+		t.Errorf("mean %v, want {50 20 -20}", m.mean)
+	}
+	if m.variance != (lab{50, 50, 50}) {
+		t.Errorf("variance %v, want {50 50 50}", m.variance)
+	}
+
+	m = learnColorModel([]lab{{50, 20, -20}, {50, 20, -20}}, color.RGBA{})
+	if m.variance != (lab{minColorVariance, minColorVariance, minColorVariance}) {
+		t.Errorf("variance of identical samples %v, want the floor %v", m.variance, minColorVariance)
+	}
+
+	// a dot lost in every sample frame
+	ref := color.RGBA{245, 34, 45, 0}
+	m = learnColorModel(nil, ref)
+	if m != referenceColorModel(ref) {
+		t.Errorf("model without samples %v, want the reference model %v", m, referenceColorModel(ref))
+	}
+	if c, _ := newColorClassifier([]colorModel{m}).classify(ref); c != 0 {
+		t.Errorf("model without samples does not classify its own reference colour")
+	}
+}
+
+// jittered are samples of c with every channel up to spread off, in steps
+func jittered(c color.RGBA, spread int) []color.RGBA {
+	out := []color.RGBA{}
+	clamp := func(v int) uint8 { return uint8(max(0, min(255, v))) }
+	for d := -spread; d <= spread; d += spread / 2 {
+		out = append(out,
+			color.RGBA{clamp(int(c.R) + d), c.G, c.B, 0},
+			color.RGBA{c.R, clamp(int(c.G) + d), c.B, 0},
+			color.RGBA{c.R, c.G, clamp(int(c.B) + d), 0},
+		)
+	}
+	return out
+}
+
+func TestColorClassifierSeparatesLearnedColors(t *testing.T) {
+	models := make([]colorModel, len(fixtureColors))
+	for i, c := range fixtureColors {
+		samples := []lab{}
+		for _, s := range jittered(c, 12) {
+			samples = append(samples, toLab(s))
+		}
+		models[i] = learnColorModel(samples, c)
+	}
+	cc := newColorClassifier(models)
+
+	for i, c := range fixtureColors {
+		for _, s := range jittered(c, 8) {
+			if got, conf := cc.classify(s); got != dotColor(i) {
+				t.Errorf("%v, a sample of colour %d, classified as %d with confidence %.2f", s, i, got, conf)
+			}
+		}
+	}
+	for _, c := range []color.RGBA{{255, 255, 255, 0}, {0, 0, 0, 0}, {128, 128, 128, 0}} {
+		if got, _ := cc.classify(c); got != unknownDot {
+			t.Errorf("%v, far from any dot colour, classified as %d", c, got)
+		}
+	}
+	if got, _ := newColorClassifier(nil).classify(fixtureColors[0]); got != unknownDot {
+		t.Errorf("classifier without models classified a colour as %d", got)
+	}
+}
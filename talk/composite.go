@@ -0,0 +1,122 @@
+package talk
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"sort"
+
+	"github.com/deosjr/elephanttalk/opencv"
+	"gocv.io/x/gocv"
+)
+
+// composite draws illuminations into the projection cimg, bottom to top:
+// in order of Z, then by page, then in the order they were created.
+// Canvases are warped onto their page first; canvases of pages we dont see are skipped
+func composite(illus []*opencv.Illumination, pages map[int]page, cimg *gocv.Mat) {
+	ordered := append([]*opencv.Illumination{}, illus...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		a, b := ordered[i], ordered[j]
+		if a.Z != b.Z {
+			return a.Z < b.Z
+		}
+		return a.Page < b.Page
+	})
+	for _, illu := range ordered {
+		if illu.Alpha <= 0 {
+			continue
+		}
+		if !illu.Canvas {
+			layer(illu, illu.Mat, nil, cimg)
+			continue
+		}
+		p, ok := pages[illu.Page]
+		if !ok {
+			continue
+		}
+		drawCanvas(illu, p.toProjector, cimg)
+	}
+}
+
+// drawCanvas warps a page canvas onto its page in the projection.
+// toProjector maps page space in cm, so we first scale canvas pixels down to cm
+func drawCanvas(illu *opencv.Illumination, toProjector homography, cimg *gocv.Mat) {
+	s := 1. / opencv.CanvasPixelsPerCM
+	h := toProjector.mul(homography{s, 0, 0, 0, s, 0, 0, 0, 1})
+	m, err := doubleSliceToMat64F(h, 3, 3, 1)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer m.Close()
+	size := image.Pt(beamerWidth, beamerHeight)
+	warped := gocv.NewMat()
+	defer warped.Close()
+	gocv.WarpPerspectiveWithParams(illu.Mat, &warped, m, size, gocv.InterpolationLinear, gocv.BorderConstant, color.RGBA{})
+	if !illu.Opaque {
+		layer(illu, warped, nil, cimg)
+		return
+	}
+	// an opaque canvas covers the sheet, not the whole projection
+	sheet := gocv.NewMatWithSizeFromScalar(gocv.NewScalar(255, 0, 0, 0), illu.Mat.Rows(), illu.Mat.Cols(), gocv.MatTypeCV8UC1)
+	defer sheet.Close()
+	coverage := gocv.NewMat()
+	defer coverage.Close()
+	gocv.WarpPerspectiveWithParams(sheet, &coverage, m, size, gocv.InterpolationNearest, gocv.BorderConstant, color.RGBA{})
+	layer(illu, warped, &coverage, cimg)
+}
+
+// layer blends src into dst according to the settings of illu.
+// coverage is a single channel mask of where src counts; if nil, it is derived from illu:
+// everything when opaque, otherwise everywhere src isnt black
+func layer(illu *opencv.Illumination, src gocv.Mat, coverage *gocv.Mat, dst *gocv.Mat) {
+	var mask gocv.Mat
+	switch {
+	case coverage != nil:
+		mask = *coverage
+	case illu.Opaque:
+		mask = gocv.NewMatWithSizeFromScalar(gocv.NewScalar(255, 0, 0, 0), src.Rows(), src.Cols(), gocv.MatTypeCV8UC1)
+		defer mask.Close()
+	default:
+		mask = gocv.NewMat()
+		defer mask.Close()
+		gray := gocv.NewMat()
+		gocv.CvtColor(src, &gray, gocv.ColorBGRToGray)
+		gocv.Threshold(gray, &mask, 0, 255, gocv.ThresholdBinary)
+		gray.Close()
+	}
+
+	// the common case needs no arithmetic
+	if illu.Blend == opencv.BlendOver && illu.Alpha >= 1 {
+		src.CopyToWithMask(dst, mask)
+		return
+	}
+
+	// out = dst + (target - dst) * alpha * mask, in floats so nothing saturates halfway
+	d, s, m := gocv.NewMat(), gocv.NewMat(), gocv.NewMat()
+	defer d.Close()
+	defer s.Close()
+	defer m.Close()
+	dst.ConvertTo(&d, gocv.MatTypeCV32FC3)
+	src.ConvertTo(&s, gocv.MatTypeCV32FC3)
+	mask.ConvertToWithParams(&m, gocv.MatTypeCV32FC1, float32(illu.Alpha/255.), 0)
+	m3 := gocv.NewMat()
+	defer m3.Close()
+	gocv.Merge([]gocv.Mat{m, m, m}, &m3)
+
+	target := gocv.NewMat()
+	defer target.Close()
+	switch illu.Blend {
+	case opencv.BlendAdd:
+		gocv.Add(d, s, &target)
+	case opencv.BlendMultiply:
+		gocv.MultiplyWithParams(d, s, &target, 1./255., -1)
+	default:
+		s.CopyTo(&target)
+	}
+	gocv.Subtract(target, d, &target)
+	gocv.Multiply(target, m3, &target)
+	gocv.Add(d, target, &d)
+	// converting back saturates, so adding past white stays white
+	d.ConvertTo(dst, gocv.MatTypeCV8UC3)
+}
@@ -0,0 +1,135 @@
+package talk
+
+import (
+	"testing"
+
+	"github.com/deosjr/elephanttalk/opencv"
+	"gocv.io/x/gocv"
+)
+
+// solid is a small 3 channel mat filled with b, g, r
+func solid(b, g, r float64) gocv.Mat {
+	return gocv.NewMatWithSizeFromScalar(gocv.NewScalar(b, g, r, 0), 2, 2, gocv.MatTypeCV8UC3)
+}
+
+// pixel is the b, g, r of m at x, y
+func pixel(m gocv.Mat, x, y int) [3]uint8 {
+	return [3]uint8{m.GetUCharAt(y, 3*x), m.GetUCharAt(y, 3*x+1), m.GetUCharAt(y, 3*x+2)}
+}
+
+func near(got, want [3]uint8) bool {
+	for i := range got {
+		if d := int(got[i]) - int(want[i]); d < -1 || d > 1 {
+			return false
+		}
+	}
+	return true
+}
+
+func TestCompositeOrder(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		// colours are b, g, r and drawn in the order given, unless z or page says otherwise
+		illus []opencv.Illumination
+		want  [3]uint8
+	}{
+		{
+			name:  "later on top",
+			illus: []opencv.Illumination{{Page: 1, Alpha: 1}, {Page: 1, Alpha: 1}},
+			want:  [3]uint8{0, 0, 200},
+		},
+		{
+			name:  "higher z on top",
+			illus: []opencv.Illumination{{Page: 1, Alpha: 1, Z: 1}, {Page: 1, Alpha: 1}},
+			want:  [3]uint8{200, 0, 0},
+		},
+		{
+			name:  "higher page on top at the same z",
+			illus: []opencv.Illumination{{Page: 2, Alpha: 1}, {Page: 1, Alpha: 1}},
+			want:  [3]uint8{200, 0, 0},
+		},
+		{
+			name:  "z before page",
+			illus: []opencv.Illumination{{Page: 1, Alpha: 1, Z: 1}, {Page: 2, Alpha: 1}},
+			want:  [3]uint8{200, 0, 0},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			colors := []gocv.Mat{solid(200, 0, 0), solid(0, 0, 200)}
+			illus := []*opencv.Illumination{}
+			for i := range tt.illus {
+				illu := tt.illus[i]
+				illu.Mat = colors[i]
+				defer illu.Mat.Close()
+				illus = append(illus, &illu)
+			}
+			dst := solid(0, 0, 0)
+			defer dst.Close()
+			composite(illus, nil, &dst)
+			if got := pixel(dst, 1, 1); got != tt.want {
+				t.Errorf("composited to %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompositeSkipsUnseenCanvas(t *testing.T) {
+	src := solid(200, 200, 200)
+	defer src.Close()
+	dst := solid(10, 20, 30)
+	defer dst.Close()
+	composite([]*opencv.Illumination{{Mat: src, Page: 7, Canvas: true, Alpha: 1}}, map[int]page{}, &dst)
+	if got := pixel(dst, 0, 0); got != [3]uint8{10, 20, 30} {
+		t.Errorf("canvas of a page not seen drawn: %v", got)
+	}
+}
+
+func TestLayer(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		illu     opencv.Illumination
+		src, dst [3]float64
+		want     [3]uint8
+	}{
+		{"over", opencv.Illumination{Alpha: 1}, [3]float64{200, 100, 50}, [3]float64{100, 100, 100}, [3]uint8{200, 100, 50}},
+		{"half over", opencv.Illumination{Alpha: 0.5}, [3]float64{200, 100, 50}, [3]float64{100, 100, 100}, [3]uint8{150, 100, 75}},
+		{"no alpha", opencv.Illumination{Alpha: 0}, [3]float64{200, 100, 50}, [3]float64{100, 100, 100}, [3]uint8{100, 100, 100}},
+		{"add saturates", opencv.Illumination{Alpha: 1, Blend: opencv.BlendAdd}, [3]float64{200, 100, 50}, [3]float64{100, 100, 100}, [3]uint8{255, 200, 150}},
+		{"half add", opencv.Illumination{Alpha: 0.5, Blend: opencv.BlendAdd}, [3]float64{200, 100, 50}, [3]float64{100, 100, 100}, [3]uint8{200, 150, 125}},
+		{"multiply", opencv.Illumination{Alpha: 1, Blend: opencv.BlendMultiply}, [3]float64{255, 128, 51}, [3]float64{200, 200, 200}, [3]uint8{200, 100, 40}},
+		{"black is transparent", opencv.Illumination{Alpha: 1}, [3]float64{0, 0, 0}, [3]float64{100, 100, 100}, [3]uint8{100, 100, 100}},
+		{"opaque black covers", opencv.Illumination{Alpha: 1, Opaque: true}, [3]float64{0, 0, 0}, [3]float64{100, 100, 100}, [3]uint8{0, 0, 0}},
+		{"half opaque black dims", opencv.Illumination{Alpha: 0.5, Opaque: true}, [3]float64{0, 0, 0}, [3]float64{100, 100, 100}, [3]uint8{50, 50, 50}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			illu := tt.illu
+			illu.Mat = solid(tt.src[0], tt.src[1], tt.src[2])
+			defer illu.Mat.Close()
+			dst := solid(tt.dst[0], tt.dst[1], tt.dst[2])
+			defer dst.Close()
+			composite([]*opencv.Illumination{&illu}, nil, &dst)
+			if got := pixel(dst, 0, 1); !near(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLayerCoverage(t *testing.T) {
+	src := solid(200, 200, 200)
+	defer src.Close()
+	dst := solid(0, 0, 0)
+	defer dst.Close()
+	// only the left column is covered
+	coverage := gocv.NewMatWithSizeFromScalar(gocv.NewScalar(0, 0, 0, 0), 2, 2, gocv.MatTypeCV8UC1)
+	defer coverage.Close()
+	coverage.SetUCharAt(0, 0, 255)
+	coverage.SetUCharAt(1, 0, 255)
+	layer(&opencv.Illumination{Alpha: 1, Opaque: true}, src, &coverage, &dst)
+	if got := pixel(dst, 0, 0); got != [3]uint8{200, 200, 200} {
+		t.Errorf("covered pixel %v, want drawn", got)
+	}
+	if got := pixel(dst, 1, 0); got != [3]uint8{0, 0, 0} {
+		t.Errorf("uncovered pixel %v, want untouched", got)
+	}
+}
@@ -0,0 +1,129 @@
+package talk
+
+import (
+	"image"
+	"math"
+	"runtime"
+	"sort"
+	"sync"
+)
+
+// cellCorner is a corner together with the partition cell that owns it
+type cellCorner struct {
+	cell   image.Rectangle
+	corner corner
+}
+
+// findAllCorners runs findCorners over all cells of the partition in parallel.
+// Overlapping cells see the same corner, but only one of them owns it, see partition.owns.
+// Corners are returned ordered by cell so the result doesnt depend on scheduling
+func findAllCorners(sp partition, cc colorClassifier) []cellCorner {
+	cells := make([]image.Rectangle, 0, len(sp.cells))
+	for k, v := range sp.cells {
+		// a corner has 5 dots
+		if len(v) < 5 {
+			continue
+		}
+		cells = append(cells, k)
+	}
+	sort.Slice(cells, func(i, j int) bool {
+		a, b := cells[i], cells[j]
+		if a.Dx() != b.Dx() {
+			return a.Dx() < b.Dx()
+		}
+		if a.Min.Y != b.Min.Y {
+			return a.Min.Y < b.Min.Y
+		}
+		return a.Min.X < b.Min.X
+	})
+
+	found := make([]*corner, len(cells))
+	work := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < runtime.NumCPU(); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				c, ok := findCorners(sp.cells[cells[i]], cc)
+				if !ok || !sp.owns(cells[i], c) {
+					continue
+				}
+				found[i] = &c
+			}
+		}()
+	}
+	for i := range cells {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+
+	corners := []cellCorner{}
+	for i, c := range found {
+		if c == nil {
+			continue
+		}
+		corners = append(corners, cellCorner{cell: cells[i], corner: *c})
+	}
+	return corners
+}
+
+// grid size of the cornerIndex used to pair corners into pages
+const cornerIndexCM = 5.0
+
+// how far along its arm we look for the next corner of a page: the long side of A4, with some margin for tilt
+const pageSearchCM = 29.7 * 1.2
+
+// cornerIndex is a uniform grid over the tops of corners,
+// to find the corners along a ray without comparing against all of them
+type cornerIndex struct {
+	size  float64
+	cells map[image.Point][]corner
+}
+
+func newCornerIndex(corners []corner, size float64) cornerIndex {
+	ci := cornerIndex{size: size, cells: map[image.Point][]corner{}}
+	for _, c := range corners {
+		k := ci.key(c.m.p)
+		ci.cells[k] = append(ci.cells[k], c)
+	}
+	return ci
+}
+
+func (ci cornerIndex) key(p point) image.Point {
+	if ci.size <= 0 {
+		return image.Point{}
+	}
+	return image.Pt(int(math.Floor(p.x/ci.size)), int(math.Floor(p.y/ci.size)))
+}
+
+// alongRay returns corners in grid cells near the ray from p in direction dir, up to maxDist away.
+// Neighbouring cells are included, so corners up to one cell size off the ray are found
+func (ci cornerIndex) alongRay(p, dir point, maxDist float64) []corner {
+	if ci.size <= 0 {
+		// without a scale there is no grid: back to comparing all pairs
+		out := []corner{}
+		for _, cs := range ci.cells {
+			out = append(out, cs...)
+		}
+		return out
+	}
+	dir = dir.div(euclidian(dir))
+	seen := map[image.Point]bool{}
+	out := []corner{}
+	for t := 0.; t <= maxDist+ci.size; t += ci.size / 2. {
+		k := ci.key(p.add(point{dir.x * t, dir.y * t}))
+		for dx := -1; dx <= 1; dx++ {
+			for dy := -1; dy <= 1; dy++ {
+				n := k.Add(image.Pt(dx, dy))
+				if seen[n] {
+					continue
+				}
+				seen[n] = true
+				out = append(out, ci.cells[n]...)
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,83 @@
+package talk
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestFindAllCornersIndependentOfOrder(t *testing.T) {
+	defer func(tol CornerTolerances) { cornerTolerances = tol }(cornerTolerances)
+	cornerTolerances = DefaultCornerTolerances
+	cc := colorClassifierFromReference(fixtureColors)
+	const pixelsPerCM = 10.
+	// ulhc and urhc of a page, sharing no dots
+	page := printedCorners(point{300, 200}, 0.3, pixelsPerCM)
+	circles := append(cornerCircles(page[0]), cornerCircles(page[1])...)
+
+	var first []cellCorner
+	for seed := int64(0); seed < 20; seed++ {
+		shuffled := append([]circle{}, circles...)
+		rand.New(rand.NewSource(seed)).Shuffle(len(shuffled), func(i, j int) {
+			shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+		})
+		pt := newPartition(pixelsPerCM)
+		for _, c := range shuffled {
+			pt.add(c)
+		}
+		got := findAllCorners(pt, cc)
+		if len(got) != 2 {
+			t.Fatalf("seed %d: found %d corners, want 2", seed, len(got))
+		}
+		tops := map[point]bool{}
+		for _, c := range got {
+			tops[c.corner.m.p] = true
+		}
+		if !tops[page[0].m.p] || !tops[page[1].m.p] {
+			t.Errorf("seed %d: found corners at %v, want %v and %v", seed, tops, page[0].m.p, page[1].m.p)
+		}
+		if seed == 0 {
+			first = got
+			continue
+		}
+		if !reflect.DeepEqual(got, first) {
+			t.Errorf("seed %d: found %v, in another order %v", seed, got, first)
+		}
+	}
+}
+
+func TestCornerIndexAlongRay(t *testing.T) {
+	const size = 50.
+	at := func(p point) corner { return corner{m: dot{p: p}} }
+	p, dir := point{100, 100}, point{1, 1}
+	along := func(d float64) point { return p.add(unit(dir).mul(d)) }
+	// off is perpendicular to the ray
+	off := unit(point{1, -1})
+	for _, tt := range []struct {
+		name  string
+		top   point
+		found bool
+	}{
+		{"on the ray", along(200), true},
+		{"at the end", along(300), true},
+		{"a bit off the ray", along(150).add(off.mul(size / 2)), true},
+		{"far off the ray", along(150).add(off.mul(5 * size)), false},
+		{"past the end", along(300 + 5*size), false},
+		{"behind", along(-5 * size), false},
+	} {
+		ci := newCornerIndex([]corner{at(tt.top)}, size)
+		got := ci.alongRay(p, dir.mul(3), 300)
+		if found := len(got) == 1 && got[0].m.p == tt.top; found != tt.found {
+			t.Errorf("%s: found %v, want %v", tt.name, found, tt.found)
+		}
+		if len(got) > 1 {
+			t.Errorf("%s: found the corner %d times", tt.name, len(got))
+		}
+	}
+
+	// without a scale every corner is a candidate
+	ci := newCornerIndex([]corner{at(along(200)), at(along(-5 * size))}, 0)
+	if got := ci.alongRay(p, dir, 300); len(got) != 2 {
+		t.Errorf("without a grid found %d corners, want 2", len(got))
+	}
+}
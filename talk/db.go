@@ -1,11 +1,19 @@
 package talk
 
 import (
-	"strings"
+	"fmt"
 )
 
 // TODO: a proper database solution, inmem is good enough for now
-var pageDB = map[uint32]page{}
+// all pages, dot and aruco alike, by how we look them up
+var pageDB = map[pageKey]pageView{}
+
+// pageKey is where a page view is in the db: dot pages by the partial id of the view,
+// aruco pages by page number, see AddArucoPage
+type pageKey struct {
+	fiducial fiducial
+	id       uint64
+}
 
 var backgroundPages = []page{}
 
@@ -27,41 +35,194 @@ func AddPageFromShorthand(ulhc, urhc, lrhc, llhc, code string) bool {
 	})
 }
 
+// pageView is a page as seen from some of its corners, clockwise starting at corner first (0 is ulhc)
+type pageView struct {
+	page  page
+	first int
+	// 3 consecutive corners, or 2 adjacent or diagonal ones
+	corners []corner
+}
+
+// pageViews are the views of p from 3 consecutive corners
+func pageViews(p page) [4]pageView {
+	return cornerViews(p, 0, 1, 2)
+}
+
+// adjacentViews are the views of p from a corner and the next one clockwise
+func adjacentViews(p page) [4]pageView {
+	return cornerViews(p, 0, 1)
+}
+
+// diagonalViews are the views of p from a corner and the one opposite it
+func diagonalViews(p page) [4]pageView {
+	return cornerViews(p, 0, 2)
+}
+
+// cornerViews are the views of p starting at each of its corners, taking corners offsets clockwise from there
+func cornerViews(p page, offsets ...int) [4]pageView {
+	cs := pageCorners(p)
+	var views [4]pageView
+	for i := range views {
+		v := pageView{page: p, first: i}
+		for _, o := range offsets {
+			v.corners = append(v.corners, cs[(i+o)%4])
+		}
+		views[i] = v
+	}
+	return views
+}
+
+// key of a view of a dot page, by its partial id
+func (v pageView) key() pageKey {
+	return pageKey{fiducial: dotFiducial, id: cornersID(v.corners)}
+}
+
+// cornersID is the id of a view from corners cs: corner ids are digits in base cornerIDs(), like in pageID.
+// Simplified ids keep their old partial ids, which have the first corner least significant
+func cornersID(cs []corner) uint64 {
+	n := cornerIDs()
+	var id uint64
+	for i := range cs {
+		c := cs[i]
+		if ids == simpleIDScheme {
+			c = cs[len(cs)-1-i]
+		}
+		id = id*n + uint64(c.id())
+	}
+	return id
+}
+
+// views of pages from 2 corners, when using two corner ids; see UseTwoCornerIDs
+var adjacentDB = map[pageKey]pageView{}
+var diagonalDB = map[pageKey]pageView{}
+
 // Each 3 consecutive corners have their own partial ID
 // We store all 4 of those for each page, and each has to be unique!
 // This allows us to find a page with only 3 corners detected
+// Views also have to differ in at least minViewDistance dots from all others, including their own page's.
+// With two corner ids the same goes for views of pairs of adjacent and diagonal corners
 func addToDB(p page) bool {
-	id1 := pagePartialID(p.ulhc.id(), p.urhc.id(), p.lrhc.id())
-	id2 := pagePartialID(p.urhc.id(), p.lrhc.id(), p.llhc.id())
-	id3 := pagePartialID(p.lrhc.id(), p.llhc.id(), p.ulhc.id())
-	id4 := pagePartialID(p.llhc.id(), p.ulhc.id(), p.urhc.id())
-	if _, ok := pageDB[id1]; ok {
-		return false
+	if ids == checkedIDScheme {
+		if err := checkedIDsSupported(); err != nil {
+			fmt.Println(err)
+			return false
+		}
+		for _, c := range pageCorners(p) {
+			if !c.checked() {
+				return false
+			}
+		}
 	}
-	if _, ok := pageDB[id2]; ok {
+	p.id = pageID(p.ulhc.id(), p.urhc.id(), p.lrhc.id(), p.llhc.id())
+	views, adjacent, diagonal := pageViews(p), adjacentViews(p), diagonalViews(p)
+	if !distinctViews(views[:], pageDB) {
 		return false
 	}
-	if _, ok := pageDB[id3]; ok {
+	if twoCornerIDs && !(distinctViews(adjacent[:], adjacentDB) && distinctViews(diagonal[:], diagonalDB)) {
 		return false
 	}
-	if _, ok := pageDB[id4]; ok {
-		return false
+	for _, v := range views {
+		pageDB[v.key()] = v
+	}
+	if !twoCornerIDs {
+		return true
+	}
+	for i := range adjacent {
+		adjacentDB[adjacent[i].key()] = adjacent[i]
+		diagonalDB[diagonal[i].key()] = diagonal[i]
+	}
+	return true
+}
+
+// addTwoCornerViews fills adjacentDB and diagonalDB with the views of dot pages already in pageDB,
+// as long as each pair of their corners identifies them on its own
+func addTwoCornerViews() error {
+	adjacent, diagonal := map[pageKey]pageView{}, map[pageKey]pageView{}
+	for k, v := range pageDB {
+		// one view per page
+		if k.fiducial != dotFiducial || v.first != 0 {
+			continue
+		}
+		a, d := adjacentViews(v.page), diagonalViews(v.page)
+		if !(distinctViews(a[:], adjacent) && distinctViews(d[:], diagonal)) {
+			p := v.page
+			return fmt.Errorf("two corner ids: page %s %s %s %s is not identified by each pair of its corners", p.ulhc.debugPrint(), p.urhc.debugPrint(), p.lrhc.debugPrint(), p.llhc.debugPrint())
+		}
+		for i := range a {
+			adjacent[a[i].key()] = a[i]
+			diagonal[d[i].key()] = d[i]
+		}
+	}
+	adjacentDB, diagonalDB = adjacent, diagonal
+	return nil
+}
+
+// distinctViews reports whether views differ enough from each other and all dot page views in db
+func distinctViews(views []pageView, db map[pageKey]pageView) bool {
+	minDist := minViewDistance()
+	for i, v := range views {
+		for k, o := range db {
+			if k.fiducial != dotFiducial {
+				continue
+			}
+			if d, _ := viewDistance(v.corners, o.corners); d < minDist {
+				return false
+			}
+		}
+		for _, o := range views[:i] {
+			if d, _ := viewDistance(v.corners, o.corners); d < minDist {
+				return false
+			}
+		}
 	}
-	p.id = pageID(p.ulhc.id(), p.urhc.id(), p.lrhc.id(), p.llhc.id())
-	pageDB[id1] = p
-	pageDB[id2] = p
-	pageDB[id3] = p
-	pageDB[id4] = p
 	return true
 }
 
+// lookupPage finds the page seen from 3 consecutive corners cs, clockwise.
+// With checked ids this is the nearest registered view, if it is close enough to be unambiguous
+func lookupPage(cs []corner) (pageView, bool) {
+	return lookupView(pageDB, cs)
+}
+
+func lookupView(db map[pageKey]pageView, cs []corner) (pageView, bool) {
+	if ids == checkedIDScheme {
+		return nearestView(db, cs)
+	}
+	if !cornersKnown(cs...) {
+		return pageView{}, false
+	}
+	v, ok := db[pageKey{fiducial: dotFiducial, id: cornersID(cs)}]
+	return v, ok
+}
+
+func nearestView(db map[pageKey]pageView, seen []corner) (pageView, bool) {
+	var best pageView
+	bestScore := checkedMinDistance
+	for k, v := range db {
+		if k.fiducial != dotFiducial {
+			continue
+		}
+		errors, erasures := viewDistance(seen, v.corners)
+		// decodable as long as 2*errors+erasures < minimum distance
+		if score := 2*errors + erasures; score < bestScore {
+			best, bestScore = v, score
+		}
+	}
+	return best, bestScore < checkedMinDistance
+}
+
+// cornerShorthand reads a corner as the colours of its dots, ll to rr, as in "rgbyy".
+// Letters are the Shorthand of palette colours.
+// Three letters are just l, m and r, with parity dots as for checked ids
 func cornerShorthand(debug string) corner {
-	s := "rgby"
+	if len(debug) == 3 {
+		return checkedCorner(shorthandColor(debug[0]), shorthandColor(debug[1]), shorthandColor(debug[2]))
+	}
 	return corner{
-		ll: dot{c: dotColor(strings.IndexRune(s, rune(debug[0])))},
-		l:  dot{c: dotColor(strings.IndexRune(s, rune(debug[1])))},
-		m:  dot{c: dotColor(strings.IndexRune(s, rune(debug[2])))},
-		r:  dot{c: dotColor(strings.IndexRune(s, rune(debug[3])))},
-		rr: dot{c: dotColor(strings.IndexRune(s, rune(debug[4])))},
+		ll: dot{c: shorthandColor(debug[0])},
+		l:  dot{c: shorthandColor(debug[1])},
+		m:  dot{c: shorthandColor(debug[2])},
+		r:  dot{c: shorthandColor(debug[3])},
+		rr: dot{c: shorthandColor(debug[4])},
 	}
 }
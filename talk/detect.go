@@ -4,22 +4,57 @@ import (
 	"image"
 	"image/color"
 	"math"
-	"sort"
 
 	"gocv.io/x/gocv"
 )
 
-func detect(img gocv.Mat, actualImage image.Image, ref []color.RGBA) map[image.Rectangle][]circle {
+// detect finds circles in img. If colour histograms are given, circles that dont look
+// like any dot colour with at least probability csf are thrown away,
+// and the others carry their probability per colour.
+// Once pixelsPerCM is known, circles that arent the size of a printed dot are thrown away as well
+func detect(img gocv.Mat, actualImage image.Image, ref []color.RGBA, hists []gocv.Mat, csf, pixelsPerCM float64) partition {
 	cimg := gocv.NewMat()
 	defer cimg.Close()
 
+	// before we draw in img
+	probMaps := backProject(img, hists)
+	defer func() {
+		for _, m := range probMaps {
+			m.Close()
+		}
+	}()
+
 	gocv.GaussianBlur(img, &cimg, image.Pt(9, 9), 2.0, 2.0, gocv.BorderDefault)
 
+	// only look for circles where the colour is close to one of the reference colours
+	var mask gocv.Mat
+	masked := useColorMask && ref != nil
+	if masked {
+		mask = colorMask(cimg, ref)
+		defer mask.Close()
+	}
+
 	gocv.CvtColor(cimg, &cimg, gocv.ColorRGBToGray)
 
+	if masked {
+		// outside of the mask everything is flat white: no edges, so no circles
+		gray := gocv.NewMatWithSizeFromScalar(gocv.NewScalar(255, 0, 0, 0), cimg.Rows(), cimg.Cols(), gocv.MatTypeCV8U)
+		cimg.CopyToWithMask(&gray, mask)
+		gray.CopyTo(&cimg)
+		gray.Close()
+		drawMaskThumbnail(&img, mask)
+	}
+
 	circleMat := gocv.NewMat()
 	defer circleMat.Close()
 
+	minRadius, maxRadius := 1, 50
+	if pixelsPerCM > 0 {
+		expectedRadius := pixelsPerCM * dotRadiusCM
+		minRadius = max(1, int(expectedRadius*(1-dotRadiusTolerance)))
+		maxRadius = int(math.Ceil(expectedRadius * (1 + dotRadiusTolerance)))
+	}
+
 	gocv.HoughCirclesWithParams(
 		cimg,
 		&circleMat,
@@ -28,23 +63,11 @@ func detect(img gocv.Mat, actualImage image.Image, ref []color.RGBA) map[image.R
 		float64(img.Rows()/64), // minDistance between centers
 		75,                     // param1
 		20,                     // param2
-		1,                      // minRadius
-		50,                     // maxRadius
+		minRadius,              // minRadius
+		maxRadius,              // maxRadius
 	)
 
-	spatialPartition := map[image.Rectangle][]circle{}
-	// webcam is 1280x720, 16x9 times 80
-	// TODO: more than one size, hierarchical division?
-	//square := 80
-	square := 130
-	square2 := square / 2.
-	for x := 0; x < 32; x++ {
-		for y := 0; y < 18; y++ {
-			ulhc := image.Pt(x*square2, y*square2)
-			urhc := image.Pt(x*square2+square, y*square2+square)
-			spatialPartition[image.Rectangle{ulhc, urhc}] = []circle{}
-		}
-	}
+	spatialPartition := newPartition(pixelsPerCM)
 
 	for i := 0; i < circleMat.Cols(); i++ {
 		v := circleMat.GetVecfAt(0, i)
@@ -54,31 +77,32 @@ func detect(img gocv.Mat, actualImage image.Image, ref []color.RGBA) map[image.R
 			y := float64(v[1])
 			r := float64(v[2])
 
-			c := actualImage.At(int(x), int(y))
-			// if we have sampled colors, only consider circles with color 'close' to a reference
-			// TODO: we could use gocv.InRange using NewMatFromScalar for lower/upper bounds then bitwiseOr img per color
-			// then join back(?) the four color-filtered versions of the image and only test Hough against that?
-			/*
-				if ref != nil {
-					closeEnough := false
-					for _, refC := range ref {
-						if colorDistance(c, refC) < 1000000 {
-							closeEnough = true
-						}
-					}
-					if !closeEnough {
-						continue
+			if mid, radius, ok := refineCircle(cimg, x, y, r); ok {
+				x, y, r = mid.x, mid.y, radius
+			}
+			if !dotSized(r, pixelsPerCM) {
+				continue
+			}
+
+			c := averageColor(actualImage, point{x, y}, r)
+
+			var probs []float64
+			if len(probMaps) > 0 {
+				probs = dotProbabilities(probMaps, point{x, y}, r)
+				likely := false
+				for _, p := range probs {
+					if p >= csf {
+						likely = true
 					}
 				}
-			*/
-
-			mid := image.Pt(int(x), int(y))
-			for rect, list := range spatialPartition {
-				if mid.In(rect) {
-					spatialPartition[rect] = append(list, circle{point{x, y}, r, c})
+				if !likely {
+					continue
 				}
 			}
 
+			mid := image.Pt(int(x), int(y))
+			spatialPartition.add(circle{point{x, y}, r, c, probs})
+
 			gocv.Circle(&img, mid, int(r), color.RGBA{0, 0, 255, 0}, 2)
 			gocv.Circle(&img, mid, 2, color.RGBA{255, 0, 0, 0}, 3)
 		}
@@ -86,167 +110,313 @@ func detect(img gocv.Mat, actualImage image.Image, ref []color.RGBA) map[image.R
 	return spatialPartition
 }
 
-// calibration pattern is four circles in a rectangle
-// check if they are equidistant to their midpoint
-func findCalibrationPattern(v []circle) bool {
-	if len(v) != 4 {
-		return false
-	}
-	midpoint := circlesMidpoint(v)
+// dots are printed with a radius of 1cm, see PrintPage
+const dotRadiusCM = 1.0
 
-	dist := euclidian(midpoint.sub(v[0].mid))
-	for _, p := range v[1:] {
-		ddist := euclidian(midpoint.sub(p.mid))
-		if !equalWithMargin(ddist, dist, 2.0) {
-			return false
-		}
+// fraction the radius of a dot may differ from its printed size
+const dotRadiusTolerance = 0.4
+
+// dotSized checks radius r against the printed dot size; without calibration anything goes
+func dotSized(r, pixelsPerCM float64) bool {
+	if pixelsPerCM <= 0 {
+		return true
 	}
-	return true
+	expectedRadius := pixelsPerCM * dotRadiusCM
+	return math.Abs(r-expectedRadius) <= expectedRadius*dotRadiusTolerance
 }
 
-func findCorners(v []circle, ref []color.RGBA) (corner, bool) {
-	// first detect lines
-	lines := [][]circle{}
-	for i, c := range v {
-		dists := map[int][]int{}
-		for j, o := range v {
-			if i == j {
-				continue
-			}
-			// magic number? bucketing distances is hard
-			d := int(euclidian(c.mid.sub(o.mid)) / 10)
-			dists[d] = append(dists[d], j)
-		}
-		var candidate []int
-		for _, indices := range dists {
-			if len(indices) == 2 {
-				candidate = indices
-				break
-			}
-		}
-		if candidate == nil {
+// refineCircle fits the blob around a circle found by Hough for a sub-pixel centre and its actual radius.
+// Dots are darker than the paper around them, so we threshold the neighbourhood in gray,
+// take the contour containing the Hough centre, and use its moments
+func refineCircle(gray gocv.Mat, x, y, r float64) (point, float64, bool) {
+	half := 1.5 * r
+	rect := image.Rect(int(x-half), int(y-half), int(x+half)+1, int(y+half)+1)
+	rect = rect.Intersect(image.Rect(0, 0, gray.Cols(), gray.Rows()))
+	if rect.Empty() {
+		return point{}, 0, false
+	}
+	region := gray.Region(rect)
+	defer region.Close()
+	bin := gocv.NewMat()
+	defer bin.Close()
+	gocv.Threshold(region, &bin, 0, 255, gocv.ThresholdBinaryInv|gocv.ThresholdOtsu)
+
+	contours := gocv.FindContours(bin, gocv.RetrievalExternal, gocv.ChainApproxNone)
+	defer contours.Close()
+	centre := image.Pt(int(x), int(y)).Sub(rect.Min)
+	for i := 0; i < contours.Size(); i++ {
+		if gocv.PointPolygonTest(contours.At(i), centre, false) < 0 {
 			continue
 		}
-		line1 := v[candidate[0]].mid.sub(c.mid)
-		line2 := v[candidate[1]].mid.sub(c.mid)
-		dot := line1.x*line2.x + line1.y*line2.y
-		angle := math.Acos(dot / (euclidian(line1) * euclidian(line2)))
-		epsilon := math.Abs(angle - math.Pi)
-		if epsilon < 0.2 {
-			lines = append(lines, []circle{v[candidate[0]], c, v[candidate[1]]})
+		blob := gocv.NewMatWithSizeFromScalar(gocv.NewScalar(0, 0, 0, 0), bin.Rows(), bin.Cols(), gocv.MatTypeCV8U)
+		gocv.DrawContours(&blob, contours, i, colorWhite, -1)
+		m := gocv.Moments(blob, true)
+		blob.Close()
+		area := m["m00"]
+		if area == 0 {
+			return point{}, 0, false
 		}
+		mid := point{m["m10"] / area, m["m01"] / area}.add(point{float64(rect.Min.X), float64(rect.Min.Y)})
+		return mid, math.Sqrt(area / math.Pi), true
 	}
-	if len(lines) != 2 {
-		return corner{}, false
+	return point{}, 0, false
+}
+
+var useColorMask bool
+
+// UseColorMask only runs circle detection on parts of the image close in colour to the
+// calibrated reference colours. This throws out most round things on the table that arent page dots
+func UseColorMask() {
+	useColorMask = true
+}
+
+// how far a pixel can be from a reference colour to be included in the mask, in opencv 8-bit lab units
+const maskToleranceL = 70
+const maskToleranceAB = 30
+
+// colorMask combines an inRange mask per reference colour, computed in lab space on img.
+// The mask is dilated a bit so the edges of the dots, which Hough needs, are included
+func colorMask(img gocv.Mat, ref []color.RGBA) gocv.Mat {
+	labImg := gocv.NewMat()
+	defer labImg.Close()
+	gocv.CvtColor(img, &labImg, gocv.ColorBGRToLab)
+
+	mask := gocv.NewMatWithSizeFromScalar(gocv.NewScalar(0, 0, 0, 0), img.Rows(), img.Cols(), gocv.MatTypeCV8U)
+	colorMask := gocv.NewMat()
+	defer colorMask.Close()
+	for _, c := range ref {
+		// opencv scales 8-bit lab to L*255/100, a+128, b+128
+		l := toLab(c)
+		ll, aa, bb := l.l*255./100., l.a+128., l.b+128.
+		lower := gocv.NewScalar(ll-maskToleranceL, aa-maskToleranceAB, bb-maskToleranceAB, 0)
+		upper := gocv.NewScalar(ll+maskToleranceL, aa+maskToleranceAB, bb+maskToleranceAB, 0)
+		gocv.InRangeWithScalar(labImg, lower, upper, &colorMask)
+		gocv.BitwiseOr(mask, colorMask, &mask)
 	}
 
-	line1 := lines[0]
-	line2 := lines[1]
-	var top, end1, end2 circle
-	switch {
-	case line1[0] == line2[0]:
-		top = line1[0]
-		end1, end2 = line1[2], line2[2]
-	case line1[2] == line2[2]:
-		top = line1[2]
-		end1, end2 = line1[0], line2[0]
-	case line1[0] == line2[2]:
-		top = line1[0]
-		end1, end2 = line1[2], line2[0]
-	case line1[2] == line2[0]:
-		top = line1[2]
-		end1, end2 = line1[0], line2[2]
-	default:
-		return corner{}, false
+	kernel := gocv.GetStructuringElement(gocv.MorphEllipse, image.Pt(7, 7))
+	defer kernel.Close()
+	gocv.Dilate(mask, &mask, kernel)
+	return mask
+}
+
+// drawMaskThumbnail shows the colour mask at a quarter size in the upper right of the debug image
+func drawMaskThumbnail(img *gocv.Mat, mask gocv.Mat) {
+	w, h := img.Cols()/4, img.Rows()/4
+	if w == 0 || h == 0 {
+		return
 	}
+	small := gocv.NewMat()
+	defer small.Close()
+	gocv.Resize(mask, &small, image.Pt(w, h), 0, 0, gocv.InterpolationLinear)
+	gocv.CvtColor(small, &small, gocv.ColorGrayToBGR)
+	region := img.Region(image.Rect(img.Cols()-w, 0, img.Cols(), h))
+	small.CopyTo(&region)
+	region.Close()
+	gocv.Rectangle(img, image.Rect(img.Cols()-w, 0, img.Cols(), h), colorWhite, 1)
+}
 
-	mid1, mid2 := line1[1], line2[1]
-	v = []circle{end1, mid1, top, mid2, end2}
+// the calibration page has a dot per palette colour in two rows, this far apart: see calibrationGrid
+const calibrationSpacingCM = 3.0
 
-	// midpoint test
-	midpoint := circlesMidpoint(v)
+// fraction by which distances between neighbouring calibration dots may differ
+const calibrationTolerance = 0.1
 
-	sortedDistances := []float64{}
-	for _, p := range v {
-		sortedDistances = append(sortedDistances, euclidian(midpoint.sub(p.mid)))
-	}
-	sort.Float64s(sortedDistances)
-	// first 3 are roughly equal, last 2 are roughly x2
-	// middle one is the 'top' of the 'arrow'
-	first3 := (sortedDistances[0] + sortedDistances[1] + sortedDistances[2]) / 3.0
-	last2 := (sortedDistances[3] + sortedDistances[4]) / 2.0
-	if !equalWithMargin(first3*2, last2, 5.0) {
-		return corner{}, false
+func calibrationCols() int {
+	return (len(palette) + 1) / 2
+}
+
+// calibrationGrid is where each palette colour is printed on the calibration page, in cm from its centre:
+// two rows, the first left to right, then the second. With an odd number of colours the second row
+// is one shorter. Both rows are centred, so the centre of the page lies midway between them.
+// With the default palette this is the original square of red, green, blue and yellow
+func calibrationGrid() []point {
+	cols := calibrationCols()
+	pts := make([]point, len(palette))
+	for i := range pts {
+		row, col := i/cols, i%cols
+		n := cols
+		if row == 1 {
+			n = len(palette) - cols
+		}
+		pts[i] = point{
+			(float64(col) - float64(n-1)/2.) * calibrationSpacingCM,
+			(float64(row) - 0.5) * calibrationSpacingCM,
+		}
 	}
-	if !equalWithMargin(sortedDistances[0], sortedDistances[1], 3.0) {
-		return corner{}, false
+	return pts
+}
+
+// calibrationRows splits circles sorted with sortCirclesAsGrid into both rows
+func calibrationRows(v []circle) (top, bottom []circle) {
+	cols := calibrationCols()
+	return v[:cols], v[cols:]
+}
+
+// calibrationCenter is the centre of the calibration page, midway between the centres of both rows
+func calibrationCenter(v []circle) point {
+	top, bottom := calibrationRows(v)
+	return circlesMidpoint(top).add(circlesMidpoint(bottom)).div(2)
+}
+
+// calibrationDistances are between neighbours in a row, and between both rows
+func calibrationDistances(v []circle) []float64 {
+	top, bottom := calibrationRows(v)
+	ds := []float64{euclidian(circlesMidpoint(top).sub(circlesMidpoint(bottom)))}
+	for _, row := range [][]circle{top, bottom} {
+		for i := 1; i < len(row); i++ {
+			ds = append(ds, euclidian(row[i].mid.sub(row[i-1].mid)))
+		}
 	}
-	if !equalWithMargin(sortedDistances[0], sortedDistances[2], 6.0) {
-		return corner{}, false
+	return ds
+}
+
+// calibrationSpacing is the average distance between neighbouring dots, ie calibrationSpacingCM in pixels
+func calibrationSpacing(v []circle) float64 {
+	ds := calibrationDistances(v)
+	sum := 0.
+	for _, d := range ds {
+		sum += d
 	}
-	if !equalWithMargin(sortedDistances[1], sortedDistances[2], 6.0) {
-		return corner{}, false
+	return sum / float64(len(ds))
+}
+
+// calibration pattern is a circle per palette colour in two evenly spaced rows
+func findCalibrationPattern(v []circle) bool {
+	if len(v) != len(palette) {
+		return false
 	}
-	if !equalWithMargin(sortedDistances[3], sortedDistances[4], 6.0) {
-		return corner{}, false
+	sorted := append([]circle{}, v...)
+	sortCirclesAsGrid(sorted, calibrationCols())
+	spacing := calibrationSpacing(sorted)
+	for _, d := range calibrationDistances(sorted) {
+		if relativeDiff(d, spacing) > calibrationTolerance {
+			return false
+		}
 	}
+	return true
+}
+
+// CornerTolerances are the thresholds findCorners uses to recognise a corner.
+// Distances are relative to the spacing of the dots under test instead of in pixels,
+// so corners are recognised regardless of how far a page is from the camera.
+type CornerTolerances struct {
+	// fraction the two neighbours of the middle dot on a line may differ in distance to it;
+	// a tilted page foreshortens one side more than the other
+	Spacing float64
+	// max angle in radians between the two halves of a line, away from straight
+	Collinear float64
+	// max angle in radians between the two arms, away from perpendicular
+	Perpendicular float64
+	// fraction the two arms may differ in length
+	ArmRatio float64
+}
 
-	// Rotate both ends around top by a quarter. One ends on top of the other: this is _left_
-	rot1 := rotateAround(top.mid, end1.mid, math.Pi/2.)
-	rot2 := rotateAround(top.mid, end2.mid, math.Pi/2.)
+// DefaultCornerTolerances accept a page tilted by about 30 degrees
+var DefaultCornerTolerances = CornerTolerances{
+	Spacing:       0.2,
+	Collinear:     0.2,
+	Perpendicular: 0.35,
+	ArmRatio:      0.3,
+}
 
-	var left, leftmid, right, rightmid circle
+var cornerTolerances = DefaultCornerTolerances
 
-	if euclidian(rot1.sub(end2.mid)) < 10 {
-		left = end1
-		leftmid = mid1
-		rightmid = mid2
-		right = end2
-	} else if euclidian(rot2.sub(end1.mid)) < 10 {
-		left = end2
-		leftmid = mid2
-		rightmid = mid1
-		right = end1
-	} else {
-		return corner{}, false
+// UseCornerTolerances replaces the thresholds used to recognise corners
+func UseCornerTolerances(t CornerTolerances) {
+	cornerTolerances = t
+}
+
+// relativeDiff is the difference between x and y as a fraction of their mean
+func relativeDiff(x, y float64) float64 {
+	if x+y == 0 {
+		return 0
 	}
+	return math.Abs(x-y) / ((x + y) / 2.)
+}
+
+// cornerLine is three dots on a line, indices into the circles passed to findCorners
+type cornerLine struct {
+	end1, mid, end2 int
+}
 
-	v = []circle{left, leftmid, top, rightmid, right}
+func findCorners(v []circle, cc colorClassifier) (corner, bool) {
+	tol := cornerTolerances
 
-	colors := make([]dotColor, 5)
+	// first detect lines: for each dot, the pair of others on opposite sides at the same distance
+	lines := []cornerLine{}
 	for i, c := range v {
-		sample := c.c
-		dist := math.MaxFloat64
-		for j, refC := range ref {
-			if d := colorDistance(sample, refC); d < dist {
-				dist = d
-				colors[i] = dotColor(j)
+		best, bestErr := cornerLine{}, math.MaxFloat64
+		for j := range v {
+			for k := j + 1; k < len(v); k++ {
+				if i == j || i == k {
+					continue
+				}
+				line1 := v[j].mid.sub(c.mid)
+				line2 := v[k].mid.sub(c.mid)
+				spacingErr := relativeDiff(euclidian(line1), euclidian(line2))
+				if spacingErr > tol.Spacing {
+					continue
+				}
+				collinearErr := math.Abs(angleBetween(line1, line2) - math.Pi)
+				if collinearErr > tol.Collinear {
+					continue
+				}
+				if err := spacingErr + collinearErr; err < bestErr {
+					best, bestErr = cornerLine{j, i, k}, err
+				}
 			}
 		}
-		rr, gg, bb, _ := sample.RGBA()
-		rr = rr >> 8
-		gg = gg >> 8
-		bb = bb >> 8
-		switch {
-		case rr < 80 && gg < 80 && bb < 80:
-			colors[i] = blueDot
-		case gg > rr && gg > bb:
-			colors[i] = greenDot
-		case rr > 2*gg && gg > bb+20:
-			colors[i] = yellowDot
-		case rr > 2*gg && rr > 3*bb:
-			colors[i] = redDot
+		if bestErr < math.MaxFloat64 {
+			lines = append(lines, best)
 		}
 	}
-	return corner{
-		ll: dot{p: left.mid, c: colors[0]},
-		l:  dot{p: leftmid.mid, c: colors[1]},
-		m:  dot{p: top.mid, c: colors[2]},
-		r:  dot{p: rightmid.mid, c: colors[3]},
-		rr: dot{p: right.mid, c: colors[4]},
-	}, true
-}
 
-func equalWithMargin(x, y, margin float64) bool {
-	return !(x-margin > y || x+margin < y)
+	// then find the one pair of lines meeting at an end: the top of the corner
+	var found []circle
+	for i, line1 := range lines {
+		for _, line2 := range lines[i+1:] {
+			top, end1, end2 := -1, 0, 0
+			for _, e1 := range [][2]int{{line1.end1, line1.end2}, {line1.end2, line1.end1}} {
+				for _, e2 := range [][2]int{{line2.end1, line2.end2}, {line2.end2, line2.end1}} {
+					if e1[0] == e2[0] && e1[1] != e2[1] {
+						top, end1, end2 = e1[0], e1[1], e2[1]
+					}
+				}
+			}
+			if top < 0 || line1.mid == line2.mid {
+				continue
+			}
+			arm1 := v[end1].mid.sub(v[top].mid)
+			arm2 := v[end2].mid.sub(v[top].mid)
+			if relativeDiff(euclidian(arm1), euclidian(arm2)) > tol.ArmRatio {
+				continue
+			}
+			if math.Abs(angleBetween(arm1, arm2)-math.Pi/2.) > tol.Perpendicular {
+				continue
+			}
+			if found != nil {
+				// ambiguous, more than one corner in these circles
+				return corner{}, false
+			}
+			// Rotating the left arm a quarter around top lands it on the right arm (see rotateAround),
+			// which in image coordinates means a negative cross product
+			mid1, mid2 := v[line1.mid], v[line2.mid]
+			if arm1.x*arm2.y-arm1.y*arm2.x > 0 {
+				end1, end2 = end2, end1
+				mid1, mid2 = mid2, mid1
+			}
+			found = []circle{v[end1], mid1, v[top], mid2, v[end2]}
+		}
+	}
+	if found == nil {
+		return corner{}, false
+	}
+
+	dots := make([]dot, 5)
+	for i, c := range found {
+		dc, conf := cc.classifyCircle(c)
+		dots[i] = dot{p: c.mid, c: dc, conf: conf}
+	}
+	return corner{ll: dots[0], l: dots[1], m: dots[2], r: dots[3], rr: dots[4]}, true
 }
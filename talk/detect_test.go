@@ -0,0 +1,223 @@
+package talk
+
+import (
+	"image/color"
+	"math"
+	"testing"
+
+	"gocv.io/x/gocv"
+)
+
+const fixtureRadius = 10
+
+// dot colours as a webcam sees them on white paper, darker than printed
+var fixtureColors = []color.RGBA{{200, 30, 30, 0}, {30, 150, 30, 0}, {30, 30, 200, 0}, {200, 170, 0, 0}}
+
+// fixture frame: a row of dots in each fixture colour on white paper,
+// with a row of round things in colours no dot is printed in below it
+func colorMaskFixture() (img gocv.Mat, dots, clutter []point) {
+	img = gocv.NewMatWithSizeFromScalar(gocv.NewScalar(255, 255, 255, 0), STRAIGHT_H, STRAIGHT_W, gocv.MatTypeCV8UC3)
+	clutterColors := []color.RGBA{{0, 0, 0, 0}, {128, 128, 128, 0}, {90, 90, 90, 0}, {170, 170, 170, 0}}
+	for i, c := range fixtureColors {
+		p := point{float64(60 + 80*i), 100}
+		gocv.Circle(&img, p.toIntPt(), fixtureRadius, c, -1)
+		dots = append(dots, p)
+	}
+	for i, c := range clutterColors {
+		p := point{float64(60 + 80*i), 230}
+		gocv.Circle(&img, p.toIntPt(), fixtureRadius, c, -1)
+		clutter = append(clutter, p)
+	}
+	return img, dots, clutter
+}
+
+// detected counts how many of pts have a circle detected on them
+func detected(pt partition, pts []point) int {
+	n := 0
+	for _, p := range pts {
+	cells:
+		for _, cs := range pt.cells {
+			for _, c := range cs {
+				if euclidian(c.mid.sub(p)) < fixtureRadius/2 {
+					n++
+					break cells
+				}
+			}
+		}
+	}
+	return n
+}
+
+func TestColorMaskDropsClutter(t *testing.T) {
+	defer func(masked bool) { useColorMask = masked }(useColorMask)
+
+	run := func(masked bool) (dots, clutter int) {
+		useColorMask = masked
+		img, dotPts, clutterPts := colorMaskFixture()
+		defer img.Close()
+		actualImage, err := img.ToImage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		pt := detect(img, actualImage, fixtureColors, nil, 0, 0)
+		return detected(pt, dotPts), detected(pt, clutterPts)
+	}
+
+	dots, clutter := run(false)
+	maskedDots, maskedClutter := run(true)
+	if dots != len(fixtureColors) || maskedDots != len(fixtureColors) {
+		t.Errorf("found %d dots unmasked and %d masked, want all %d", dots, maskedDots, len(fixtureColors))
+	}
+	if clutter == 0 {
+		t.Fatalf("unmasked run found none of the clutter, the fixture tests nothing")
+	}
+	if maskedClutter >= clutter {
+		t.Errorf("masked run found %d round things that arent dots, unmasked %d: want fewer", maskedClutter, clutter)
+	}
+}
+
+// armedCorner has its top at m and arms left and right, with the middle dots at fractions lf and rf along them
+func armedCorner(m, left, right point, lf, rf float64) corner {
+	return corner{
+		ll: dot{p: m.add(left)},
+		l:  dot{p: m.add(left.mul(lf))},
+		m:  dot{p: m},
+		r:  dot{p: m.add(right.mul(rf))},
+		rr: dot{p: m.add(right)},
+	}
+}
+
+// cornerCircles are the dots of c as detected circles, coloured ll to rr in fixture colours
+func cornerCircles(c corner) []circle {
+	out := []circle{}
+	for i, d := range []dot{c.ll, c.l, c.m, c.r, c.rr} {
+		out = append(out, circle{mid: d.p, r: 5, c: fixtureColors[i%len(fixtureColors)]})
+	}
+	return out
+}
+
+func TestFindCorners(t *testing.T) {
+	defer func(tol CornerTolerances) { cornerTolerances = tol }(cornerTolerances)
+	cornerTolerances = DefaultCornerTolerances
+	cc := colorClassifierFromReference(fixtureColors)
+	m := point{300, 160}
+	// arms of a printed corner are 5cm, here at 10 pixels per cm
+	const arm = 50.
+
+	for _, tt := range []struct {
+		name string
+		c    corner
+		ok   bool
+	}{
+		{"upright", testCorner(m, 0, arm), true},
+		{"half size", testCorner(m, 0.3, arm/2), true},
+		{"twice the size", testCorner(m, 2, arm*2), true},
+		{"twice the size upside down", testCorner(m, math.Pi, arm*2), true},
+		{"one arm foreshortened", armedCorner(m, point{0, arm * 0.8}, point{arm, 0}, 0.5, 0.5), true},
+		{"one arm foreshortened in perspective", armedCorner(m, point{0, arm * 0.8}, point{arm, 0}, 0.47, 0.5), true},
+		{"arms too different", armedCorner(m, point{0, arm * 0.6}, point{arm, 0}, 0.5, 0.5), false},
+		{"middle dot too far off", armedCorner(m, point{0, arm}, point{arm, 0}, 0.5, 0.62), false},
+		{"not perpendicular", armedCorner(m, point{0, arm}, rotateAround(point{}, point{arm, 0}, math.Pi/6), 0.5, 0.5), false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			c := tt.c
+			got, ok := findCorners(cornerCircles(c), cc)
+			if ok != tt.ok {
+				t.Fatalf("found a corner: %v, want %v", ok, tt.ok)
+			}
+			if !ok {
+				return
+			}
+			for i, pair := range [][2]dot{{got.ll, c.ll}, {got.l, c.l}, {got.m, c.m}, {got.r, c.r}, {got.rr, c.rr}} {
+				if pair[0].p != pair[1].p {
+					t.Errorf("dot %d at %v, want %v", i, pair[0].p, pair[1].p)
+				}
+				if want := dotColor(i % len(fixtureColors)); pair[0].c != want {
+					t.Errorf("dot %d classified as %v, want %v", i, pair[0].c, want)
+				}
+			}
+		})
+	}
+}
+
+func TestFindCornersRejectsTwoCorners(t *testing.T) {
+	defer func(tol CornerTolerances) { cornerTolerances = tol }(cornerTolerances)
+	cornerTolerances = DefaultCornerTolerances
+	cc := colorClassifierFromReference(fixtureColors)
+	v := append(cornerCircles(testCorner(point{100, 100}, 0, 50)), cornerCircles(testCorner(point{300, 100}, 0, 50))...)
+	if c, ok := findCorners(v, cc); ok {
+		t.Errorf("found one corner %v in the circles of two", c.debugPrint())
+	}
+}
+
+// grayDot is a white gray image with a black dot of radius r centred at mid, on whole pixels
+func grayDot(mid point, r float64) gocv.Mat {
+	img := gocv.NewMatWithSizeFromScalar(gocv.NewScalar(255, 0, 0, 0), 80, 100, gocv.MatTypeCV8U)
+	for y := 0; y < img.Rows(); y++ {
+		for x := 0; x < img.Cols(); x++ {
+			if euclidian(point{float64(x), float64(y)}.sub(mid)) <= r {
+				img.SetUCharAt(y, x, 0)
+			}
+		}
+	}
+	return img
+}
+
+func TestRefineCircle(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		mid     point
+		r       float64
+		houghAt point
+		houghR  float64
+	}{
+		{"found where it is", point{40.3, 30.7}, 10, point{40, 31}, 10},
+		{"found off centre", point{50.6, 40.2}, 12, point{53, 38}, 10},
+		{"found too large", point{30.5, 35.5}, 8, point{31, 35}, 13},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			img := grayDot(tt.mid, tt.r)
+			defer img.Close()
+			mid, r, ok := refineCircle(img, tt.houghAt.x, tt.houghAt.y, tt.houghR)
+			if !ok {
+				t.Fatal("no blob found around the hough centre")
+			}
+			if !closeTo(mid, tt.mid, 0.15) {
+				t.Errorf("refined centre %v, want %v", mid, tt.mid)
+			}
+			if math.Abs(r-tt.r) > 0.3 {
+				t.Errorf("refined radius %.2f, want %.2f", r, tt.r)
+			}
+		})
+	}
+}
+
+func TestRefineCircleOutsideImage(t *testing.T) {
+	img := grayDot(point{40, 30}, 10)
+	defer img.Close()
+	if _, _, ok := refineCircle(img, -50, -50, 10); ok {
+		t.Errorf("refined a circle outside the image")
+	}
+}
+
+func TestDotSized(t *testing.T) {
+	const pixelsPerCM = 10
+	for _, tt := range []struct {
+		r           float64
+		pixelsPerCM float64
+		ok          bool
+	}{
+		{10, pixelsPerCM, true},
+		{6.5, pixelsPerCM, true},
+		{13.5, pixelsPerCM, true},
+		{5.5, pixelsPerCM, false},
+		{14.5, pixelsPerCM, false},
+		{40, pixelsPerCM, false},
+		// not calibrated yet
+		{40, 0, true},
+	} {
+		if got := dotSized(tt.r, tt.pixelsPerCM); got != tt.ok {
+			t.Errorf("radius %v at %v pixels per cm kept: %v, want %v", tt.r, tt.pixelsPerCM, got, tt.ok)
+		}
+	}
+}
@@ -23,6 +23,14 @@ func (p point) div(n float64) point {
 	return point{p.x / n, p.y / n}
 }
 
+func (p point) mul(n float64) point {
+	return point{p.x * n, p.y * n}
+}
+
+func (p point) dot(q point) float64 {
+	return p.x*q.x + p.y*q.y
+}
+
 func (p point) toIntPt() image.Point {
 	return image.Pt(int(p.x), int(p.y))
 }
@@ -31,6 +39,8 @@ type circle struct {
 	mid point
 	r   float64
 	c   color.Color
+	// back projected probability per dotColor, if we have colour histograms
+	probs []float64
 }
 
 func euclidian(p point) float64 {
@@ -68,21 +78,43 @@ func rotateAround(pivot, p point, radians float64) point {
 
 func angleBetween(u, v point) float64 {
 	dot := u.x*v.x + u.y*v.y
-	return math.Acos(dot / (euclidian(u) * euclidian(v)))
+	// rounding can push the cosine just outside [-1,1] for (anti)parallel vectors
+	cos := math.Max(-1, math.Min(1, dot/(euclidian(u)*euclidian(v))))
+	return math.Acos(cos)
 }
 
-func sortCirclesAsCorners(circles []circle) {
-	// ulhc, urhc, llhc, lrhc
+// sortCirclesAsGrid orders circles laid out in rows of cols, like on the calibration page:
+// row by row from the top, each from left to right
+func sortCirclesAsGrid(circles []circle, cols int) {
 	sort.Slice(circles, func(i, j int) bool {
-		return circles[i].mid.x+circles[i].mid.y < circles[j].mid.x+circles[j].mid.y
+		return circles[i].mid.y < circles[j].mid.y
 	})
-	// since origin is upperleft, ulhc is first and lrhc is last
-	// urhc and llhc is unordered yet; urhc is assumed to be higher up
-	if circles[1].mid.y > circles[2].mid.y {
-		circles[1], circles[2] = circles[2], circles[1]
+	for i := 0; i < len(circles); i += cols {
+		end := i + cols
+		if end > len(circles) {
+			end = len(circles)
+		}
+		row := circles[i:end]
+		sort.Slice(row, func(i, j int) bool {
+			return row[i].mid.x < row[j].mid.x
+		})
 	}
 }
 
+// circlesRect is the bounding box of circles
+func circlesRect(circles []circle) image.Rectangle {
+	r := image.Rectangle{}
+	for i, c := range circles {
+		cr := image.Rectangle{c.mid.add(point{-c.r, -c.r}).toIntPt(), c.mid.add(point{c.r, c.r}).toIntPt()}
+		if i == 0 {
+			r = cr
+			continue
+		}
+		r = r.Union(cr)
+	}
+	return r
+}
+
 func circlesMidpoint(circles []circle) point {
 	mid := circles[0].mid
 	for _, c := range circles[1:] {
@@ -0,0 +1,95 @@
+package talk
+
+import (
+	"image"
+	"image/color"
+
+	"gocv.io/x/gocv"
+)
+
+// bins per channel of the 3D lab histograms in calibrationResults.histograms,
+// which are saved in calibration_results.json and take precedence over the colorClassifier models
+const HIST_SIZE = 16
+
+// default for straightChessboard.Csf when calibration.json doesnt set one
+const defaultCsf = 0.2
+
+var histRanges = []float64{0, 256, 0, 256, 0, 256}
+
+// colorHistograms accumulates a lab histogram per dot from straightened frames of the calibration page.
+// pattern is sorted as corners, which means its dots are in dotColor order.
+func colorHistograms(frames []gocv.Mat, pattern []circle) []gocv.Mat {
+	hists := make([]gocv.Mat, len(pattern))
+	for i := range hists {
+		hists[i] = gocv.NewMat()
+	}
+	labImg := gocv.NewMat()
+	defer labImg.Close()
+	for f, frame := range frames {
+		gocv.CvtColor(frame, &labImg, gocv.ColorBGRToLab)
+		for i, c := range pattern {
+			mask := gocv.NewMatWithSizeFromScalar(gocv.NewScalar(0, 0, 0, 0), frame.Rows(), frame.Cols(), gocv.MatTypeCV8U)
+			gocv.Circle(&mask, c.mid.toIntPt(), int(c.r*dotSampleRadius)+1, color.RGBA{255, 255, 255, 0}, -1)
+			gocv.CalcHist([]gocv.Mat{labImg}, []int{0, 1, 2}, mask, &hists[i], []int{HIST_SIZE, HIST_SIZE, HIST_SIZE}, histRanges, f > 0)
+			mask.Close()
+		}
+	}
+	// scale so back projection gives 0-255 where 255 is the most likely colour of the dot
+	for i := range hists {
+		gocv.Normalize(hists[i], &hists[i], 0, 255, gocv.NormMinMax)
+	}
+	return hists
+}
+
+// backProject returns a probability map per colour histogram, same size as img
+func backProject(img gocv.Mat, hists []gocv.Mat) []gocv.Mat {
+	labImg := gocv.NewMat()
+	defer labImg.Close()
+	gocv.CvtColor(img, &labImg, gocv.ColorBGRToLab)
+	maps := make([]gocv.Mat, len(hists))
+	for i, hist := range hists {
+		maps[i] = gocv.NewMat()
+		gocv.CalcBackProject([]gocv.Mat{labImg}, []int{0, 1, 2}, hist, &maps[i], histRanges, false)
+	}
+	return maps
+}
+
+// dotProbabilities averages each probability map over the inner part of a dot, scaled to [0,1]
+func dotProbabilities(maps []gocv.Mat, mid point, r float64) []float64 {
+	rr := r * dotSampleRadius
+	if rr < 1 {
+		rr = 1
+	}
+	rect := image.Rect(int(mid.x-rr), int(mid.y-rr), int(mid.x+rr)+1, int(mid.y+rr)+1)
+	probs := make([]float64, len(maps))
+	for i, m := range maps {
+		rect := rect.Intersect(image.Rect(0, 0, m.Cols(), m.Rows()))
+		if rect.Empty() {
+			continue
+		}
+		region := m.Region(rect)
+		probs[i] = region.Mean().Val1 / 255.
+		region.Close()
+	}
+	return probs
+}
+
+// classifyProbabilities picks the most likely colour from back projected probabilities,
+// with a confidence relative to all colours combined
+func classifyProbabilities(probs []float64, minConfidence float64) (dotColor, float64) {
+	best, total := 0, 0.
+	for i, p := range probs {
+		total += p
+		if p > probs[best] {
+			best = i
+		}
+	}
+	if total == 0 {
+		return unknownDot, 0
+	}
+	confidence := probs[best] / total
+	if confidence < minConfidence {
+		return unknownDot, confidence
+	}
+	return dotColor(best), confidence
+}
@@ -0,0 +1,168 @@
+package talk
+
+import (
+	"fmt"
+	"math"
+)
+
+// homography is a 3x3 projective transform in row-major order, mapping points
+// from one plane to another. nil means no homography has been calibrated.
+type homography []float64
+
+func identityHomography() homography {
+	return homography{1, 0, 0, 0, 1, 0, 0, 0, 1}
+}
+
+func (h homography) apply(p point) point {
+	w := h[6]*p.x + h[7]*p.y + h[8]
+	return point{
+		(h[0]*p.x + h[1]*p.y + h[2]) / w,
+		(h[3]*p.x + h[4]*p.y + h[5]) / w,
+	}
+}
+
+// mul returns h*g, i.e. the transform that first applies g, then h
+func (h homography) mul(g homography) homography {
+	out := make(homography, 9)
+	for r := 0; r < 3; r++ {
+		for c := 0; c < 3; c++ {
+			for k := 0; k < 3; k++ {
+				out[3*r+c] += h[3*r+k] * g[3*k+c]
+			}
+		}
+	}
+	return out
+}
+
+func (h homography) inverse() (homography, error) {
+	a, b, c := h[0], h[1], h[2]
+	d, e, f := h[3], h[4], h[5]
+	g, i, j := h[6], h[7], h[8]
+	det := a*(e*j-f*i) - b*(d*j-f*g) + c*(d*i-e*g)
+	if math.Abs(det) < EPSILON {
+		return nil, fmt.Errorf("homography is singular")
+	}
+	return homography{
+		(e*j - f*i) / det, (c*i - b*j) / det, (b*f - c*e) / det,
+		(f*g - d*j) / det, (a*j - c*g) / det, (c*d - a*f) / det,
+		(d*i - e*g) / det, (b*g - a*i) / det, (a*e - b*d) / det,
+	}, nil
+}
+
+// scaleAt is the local scale factor of h around p: how long a unit length at p becomes
+func (h homography) scaleAt(p point) float64 {
+	q := h.apply(p)
+	dx := euclidian(h.apply(p.add(point{1, 0})).sub(q))
+	dy := euclidian(h.apply(p.add(point{0, 1})).sub(q))
+	return (dx + dy) / 2.
+}
+
+// solveHomography finds the homography mapping src onto dst in the least squares sense,
+// using the normalised direct linear transform. Needs at least 4 point pairs.
+func solveHomography(src, dst []point) (homography, error) {
+	if len(src) != len(dst) {
+		return nil, fmt.Errorf("homography needs pairs of points, got %d and %d", len(src), len(dst))
+	}
+	if len(src) < 4 {
+		return nil, fmt.Errorf("homography needs at least 4 points, got %d", len(src))
+	}
+	// normalise both point sets for numerical stability
+	tsrc := normalisation(src)
+	tdst := normalisation(dst)
+
+	// with h[8] fixed at 1, each pair gives two linear equations in the remaining 8 unknowns:
+	// [x y 1 0 0 0 -ux -uy] h = u
+	// [0 0 0 x y 1 -vx -vy] h = v
+	// solved as the normal equations AtA h = Atb
+	ata := make([][]float64, 8)
+	for i := range ata {
+		ata[i] = make([]float64, 8)
+	}
+	atb := make([]float64, 8)
+	addRow := func(row []float64, b float64) {
+		for i := 0; i < 8; i++ {
+			for j := 0; j < 8; j++ {
+				ata[i][j] += row[i] * row[j]
+			}
+			atb[i] += row[i] * b
+		}
+	}
+	for i := range src {
+		p, q := tsrc.apply(src[i]), tdst.apply(dst[i])
+		addRow([]float64{p.x, p.y, 1, 0, 0, 0, -q.x * p.x, -q.x * p.y}, q.x)
+		addRow([]float64{0, 0, 0, p.x, p.y, 1, -q.y * p.x, -q.y * p.y}, q.y)
+	}
+	x, err := solveLinear(ata, atb)
+	if err != nil {
+		return nil, err
+	}
+	hn := homography{x[0], x[1], x[2], x[3], x[4], x[5], x[6], x[7], 1}
+
+	// denormalise: H = Tdst^-1 * Hn * Tsrc
+	tdstInv, err := tdst.inverse()
+	if err != nil {
+		return nil, err
+	}
+	h := tdstInv.mul(hn).mul(tsrc)
+	if math.Abs(h[8]) < EPSILON {
+		return nil, fmt.Errorf("degenerate homography")
+	}
+	for i := range h {
+		h[i] /= h[8]
+	}
+	return h, nil
+}
+
+// normalisation moves the centroid of pts to the origin
+// and scales them so their average distance to it is sqrt(2)
+func normalisation(pts []point) homography {
+	var c point
+	for _, p := range pts {
+		c = c.add(p)
+	}
+	c = c.div(float64(len(pts)))
+	var d float64
+	for _, p := range pts {
+		d += euclidian(p.sub(c))
+	}
+	d /= float64(len(pts))
+	s := 1.
+	if d > EPSILON {
+		s = math.Sqrt2 / d
+	}
+	return homography{s, 0, -s * c.x, 0, s, -s * c.y, 0, 0, 1}
+}
+
+// solveLinear solves a x = b by gaussian elimination with partial pivoting
+func solveLinear(a [][]float64, b []float64) ([]float64, error) {
+	n := len(b)
+	for col := 0; col < n; col++ {
+		pivot := col
+		for r := col + 1; r < n; r++ {
+			if math.Abs(a[r][col]) > math.Abs(a[pivot][col]) {
+				pivot = r
+			}
+		}
+		if math.Abs(a[pivot][col]) < EPSILON {
+			return nil, fmt.Errorf("singular system, points might be collinear")
+		}
+		a[col], a[pivot] = a[pivot], a[col]
+		b[col], b[pivot] = b[pivot], b[col]
+		for r := col + 1; r < n; r++ {
+			f := a[r][col] / a[col][col]
+			for c := col; c < n; c++ {
+				a[r][c] -= f * a[col][c]
+			}
+			b[r] -= f * b[col]
+		}
+	}
+	x := make([]float64, n)
+	for r := n - 1; r >= 0; r-- {
+		sum := b[r]
+		for c := r + 1; c < n; c++ {
+			sum -= a[r][c] * x[c]
+		}
+		x[r] = sum / a[r][r]
+	}
+	return x, nil
+}
@@ -0,0 +1,93 @@
+package talk
+
+import (
+	"math"
+	"testing"
+)
+
+// a projective transform with rotation, scale, shear, translation and keystone
+var testHomography = homography{1.2, -0.3, 40, 0.25, 0.9, -15, 0.0004, -0.0002, 1}
+
+func closeTo(a, b point, tolerance float64) bool {
+	return euclidian(a.sub(b)) < tolerance
+}
+
+func TestSolveHomographyRecoversKnownMatrix(t *testing.T) {
+	for _, src := range [][]point{
+		{{0, 0}, {600, 0}, {600, 331}, {0, 331}},
+		{{10, 20}, {500, 40}, {560, 300}, {30, 280}, {300, 150}, {120, 200}, {420, 90}},
+	} {
+		dst := make([]point, len(src))
+		for i, p := range src {
+			dst[i] = testHomography.apply(p)
+		}
+		h, err := solveHomography(src, dst)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range h {
+			if math.Abs(h[i]-testHomography[i]) > 1e-6*math.Max(1, math.Abs(testHomography[i])) {
+				t.Errorf("%d points: solved %v, want %v", len(src), h, testHomography)
+				break
+			}
+		}
+	}
+}
+
+func TestHomographyInverse(t *testing.T) {
+	inv, err := testHomography.inverse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []point{{0, 0}, {123.4, 56.7}, {600, 331}, {-40, 900}} {
+		if q := inv.apply(testHomography.apply(p)); !closeTo(q, p, 1e-9) {
+			t.Errorf("inverse of apply maps %v to %v", p, q)
+		}
+	}
+	id := inv.mul(testHomography)
+	for i, want := range identityHomography() {
+		if math.Abs(id[i]/id[8]-want) > 1e-9 {
+			t.Fatalf("inverse times h is %v, want the identity", id)
+		}
+	}
+	if _, err := (homography{1, 2, 3, 2, 4, 6, 0, 0, 1}).inverse(); err == nil {
+		t.Errorf("no error inverting a singular homography")
+	}
+}
+
+func TestSolveHomographyNeedsFourPointsInGeneralPosition(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		src, dst []point
+	}{
+		{"three points", []point{{0, 0}, {1, 0}, {0, 1}}, []point{{0, 0}, {2, 0}, {0, 2}}},
+		{"unpaired points", []point{{0, 0}, {1, 0}, {1, 1}, {0, 1}}, []point{{0, 0}, {2, 0}, {2, 2}}},
+		{"collinear points", []point{{0, 0}, {1, 1}, {2, 2}, {3, 3}}, []point{{0, 0}, {2, 1}, {4, 2}, {6, 3}}},
+	} {
+		if h, err := solveHomography(tt.src, tt.dst); err == nil {
+			t.Errorf("%s: solved %v, want an error", tt.name, h)
+		}
+	}
+}
+
+func TestHomographyScaleAt(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		h    homography
+		p    point
+		want float64
+	}{
+		{"identity", identityHomography(), point{10, 20}, 1},
+		{"uniform scale with translation", homography{2.5, 0, 100, 0, 2.5, -30, 0, 0, 1}, point{300, 100}, 2.5},
+		// rotating by 90 degrees does not scale
+		{"rotation", homography{0, -1, 0, 1, 0, 0, 0, 0, 1}, point{7, 3}, 1},
+		// x doubles and y triples
+		{"non-uniform scale", homography{2, 0, 0, 0, 3, 0, 0, 0, 1}, point{5, 5}, 2.5},
+		// w is 2 at the origin, halving lengths there
+		{"projective", homography{1, 0, 0, 0, 1, 0, 0, 0, 2}, point{0, 0}, 0.5},
+	} {
+		if got := tt.h.scaleAt(tt.p); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%s: scale %v at %v, want %v", tt.name, got, tt.p, tt.want)
+		}
+	}
+}
@@ -35,18 +35,33 @@ func clear(l lisp.Lisp) {
 }
 
 // write a recognised page to lisp, storing it in datalog
-// returns an int identifier for this page, which is unique in this frame only
-func page2lisp(l lisp.Lisp, p page, pts []point) int {
+// pts are expected in beamerspace, see calibrationResults.toBeamer, and page code draws illuminations with them
+// state is whether the page is actually seen this frame or its position is predicted by the tracker
+// the page homography to the space of pts is stored as three rows, for use with page->projector,
+// and the one to straightened webcamspace likewise, for use with page->camera
+// 'id is the page as registered, shared by all its physical copies; 'instance tells those copies apart
+// and stays the same across frames for as long as the copy is tracked
+// returns an int identifier for this copy of the page, which is unique in this frame only
+func page2lisp(l lisp.Lisp, p page, pts []point, state trackState) int {
 	lisppoints := fmt.Sprintf("(list (cons %f %f) (cons %f %f) (cons %f %f) (cons %f %f))", pts[0].x, pts[0].y, pts[1].x, pts[1].y, pts[2].x, pts[2].y, pts[3].x, pts[3].y)
 	dID, _ := l.Eval(fmt.Sprintf(`(dl_record 'page
         ('id %d)
+        ('instance %d)
         ('points %s)
         ('angle %f)
+        ('state '%s)
+        ('homography %s)
+        ('camera-homography %s)
         ('code %q)
-    )`, p.id, lisppoints, p.angle, p.code))
+    )`, p.id, p.instance, lisppoints, p.angle, state, homography2lisp(p.toProjector), homography2lisp(p.toCamera), p.code))
 	return int(dID.AsNumber())
 }
 
+func homography2lisp(h homography) string {
+	return fmt.Sprintf("(list (list %f %f %f) (list %f %f %f) (list %f %f %f))", h[0], h[1], h[2], h[3], h[4], h[5], h[6], h[7], h[8])
+}
+
+// pages and their datalogIDs are by instance
 func evalPages(l lisp.Lisp, pages map[uint64]page, datalogIDs map[uint64]int) {
 	for _, page := range backgroundPages {
 		_, err := l.Eval(page.code)
@@ -58,8 +73,8 @@ func evalPages(l lisp.Lisp, pages map[uint64]page, datalogIDs map[uint64]int) {
 	for _, page := range pages {
 		// v1 of claim/wish/when
 		// run each pages' code, including claims, wishes and whens
-		// set 'this to the page's id
-		_, err := l.Eval(fmt.Sprintf("(define this %d)", datalogIDs[page.id]))
+		// set 'this to the id of this copy of the page
+		_, err := l.Eval(fmt.Sprintf("(define this %d)", datalogIDs[page.instance]))
 		if err != nil {
 			fmt.Println(err)
 		}
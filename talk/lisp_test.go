@@ -0,0 +1,47 @@
+package talk
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestPageHomographiesInLisp(t *testing.T) {
+	l := LoadRealTalk()
+	p := testPage(1, 100, 100, 200, 150)
+	camera := []point{p.ulhc.m.p, p.urhc.m.p, p.lrhc.m.p, p.llhc.m.p}
+	projector := make([]point, 4)
+	for i, pt := range camera {
+		projector[i] = pt.mul(2)
+	}
+	var err error
+	p.toCamera, p.toProjector, err = pageHomographies(camera, projector)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page2lisp(l, p, projector, trackVisible)
+
+	// the lower right corner top, in camera and projector space
+	for _, tt := range []struct {
+		fn, attr string
+		want     point
+	}{
+		{"page->camera", "camera-homography", camera[2]},
+		{"page->projector", "homography", projector[2]},
+	} {
+		h := fmt.Sprintf("(car (dl_find ,?h where ((,?id (page %s) ,?h))))", tt.attr)
+		var got point
+		for _, c := range []struct {
+			f string
+			v *float64
+		}{{"car", &got.x}, {"cdr", &got.y}} {
+			e, err := l.Eval(fmt.Sprintf("(%s (%s %s (cons %f %f)))", c.f, tt.fn, h, cornerTopsCM[2].x, cornerTopsCM[2].y))
+			if err != nil {
+				t.Fatalf("%s: %v", tt.fn, err)
+			}
+			*c.v = e.AsNumber()
+		}
+		if euclidian(got.sub(tt.want)) > 1e-3 {
+			t.Errorf("%s of the lrhc corner top is %v, want %v", tt.fn, got, tt.want)
+		}
+	}
+}
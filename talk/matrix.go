@@ -43,6 +43,22 @@ func matsToFloatSlice32F(mats []gocv.Mat) [][]float32 {
 	return data
 }
 
+func float32ToFloat64(data []float32) []float64 {
+	out := make([]float64, len(data))
+	for i, v := range data {
+		out[i] = float64(v)
+	}
+	return out
+}
+
+func float32sToFloat64s(data [][]float32) [][]float64 {
+	var out [][]float64
+	for _, d := range data {
+		out = append(out, float32ToFloat64(d))
+	}
+	return out
+}
+
 func matToFloatSlice16S(mat gocv.Mat) []int32 {
 	var data []int32
 	rows := mat.Rows()
@@ -1,29 +1,97 @@
 package talk
 
-import (
-	"image/color"
-)
+// idScheme decides which dots of a corner make up page ids
+type idScheme int
 
-// using CIELAB color picker and comparing with reference material from dynamicland
-// red6, green7, purple8, orange6
-var cielabRed = color.RGBA{245, 34, 45, 0}
-var cielabGreen = color.RGBA{56, 158, 13, 0}
-var cielabBlue = color.RGBA{57, 16, 133, 0}
-var cielabYellow = color.RGBA{250, 140, 22, 0}
+const (
+	// all 5 dots of each corner carry data
+	fullIDScheme idScheme = iota
+	// leave out the furthest corner dots
+	// This _drastically_ reduces amount of unique possible pages, but gives stability in detection
+	simpleIDScheme
+	// same data dots and ids as simple, but the furthest dots are parity, see checked.go
+	checkedIDScheme
+)
 
-// If true, leave out the furthest corner dots
-// This _drastically_ reduces amount of unique possible pages, but gives stability in detection
-var simpleIDs bool
+var ids = fullIDScheme
 
 func UseSimplifiedIDs() {
-	simpleIDs = true
+	ids = simpleIDScheme
+}
+
+// UseCheckedIDs recognises pages even with a few misread dots, at the cost of fewer possible pages.
+// All pages need parity dots: give their corners in shorthand as just the middle 3 dots
+func UseCheckedIDs() {
+	ids = checkedIDScheme
+}
+
+var twoCornerIDs bool
+
+// UseTwoCornerIDs recognises pages with only two corners in view, adjacent or diagonal,
+// by only registering pages that each pair of their corners identifies on its own.
+// This leaves a lot fewer possible pages: best call it before adding any.
+// Pages already added are checked too, and if any pair of corners doesnt tell them apart we keep using 3 corners
+func UseTwoCornerIDs() error {
+	if err := addTwoCornerViews(); err != nil {
+		return err
+	}
+	twoCornerIDs = true
+	return nil
+}
+
+// fiducial is how a page is marked, so we can recognise it
+type fiducial int
+
+const (
+	// coloured dots in each corner, see detect.go
+	dotFiducial fiducial = iota
+	// a black and white square marker in each corner, see aruco.go
+	arucoFiducial
+)
+
+func (f fiducial) String() string {
+	if f == arucoFiducial {
+		return "aruco"
+	}
+	return "dots"
 }
 
 type page struct {
 	id                     uint64
+	fiducial               fiducial
 	ulhc, urhc, lrhc, llhc corner
 	angle                  float64
 	code                   string
+	// which physical copy of the page this is, as there can be several; see pageTracker
+	instance uint64
+	// from page space to straightened webcamspace and to beamerspace, see pageHomographies
+	toCamera, toProjector homography
+}
+
+// page space is centimetres on the A4 sheet, with the origin in its upper left and y pointing down
+const a4WidthCM, a4HeightCM = 21.0, 29.7
+
+// where the m dot of each corner is printed in page space, clockwise from ulhc:
+// dots have a 1cm radius and half a radius margin, see PrintPage
+var cornerTopsCM = []point{
+	{1.5, 1.5},
+	{a4WidthCM - 1.5, 1.5},
+	{a4WidthCM - 1.5, a4HeightCM - 1.5},
+	{1.5, a4HeightCM - 1.5},
+}
+
+// pageHomographies fits the printed corner tops to where we see them, and to where they are in beamerspace.
+// camera and projector are the corner tops clockwise from ulhc
+func pageHomographies(camera, projector []point) (toCamera, toProjector homography, err error) {
+	toCamera, err = solveHomography(cornerTopsCM, camera)
+	if err != nil {
+		return nil, nil, err
+	}
+	toProjector, err = solveHomography(cornerTopsCM, projector)
+	if err != nil {
+		return nil, nil, err
+	}
+	return toCamera, toProjector, nil
 }
 
 // to define left and right under rotation:
@@ -34,72 +102,84 @@ type corner struct {
 }
 
 func (c corner) debugPrint() string {
-	s := []string{"r", "g", "b", "y"}
-	return s[c.ll.c] + s[c.l.c] + s[c.m.c] + s[c.r.c] + s[c.rr.c]
+	out := ""
+	for _, d := range []dot{c.ll, c.l, c.m, c.r, c.rr} {
+		out += string(d.c.shorthand())
+	}
+	return out
+}
+
+// known reports whether all dots that make up the id of this corner have a known colour
+func (c corner) known() bool {
+	if c.l.c == unknownDot || c.m.c == unknownDot || c.r.c == unknownDot {
+		return false
+	}
+	if ids != fullIDScheme {
+		return true
+	}
+	return c.ll.c != unknownDot && c.rr.c != unknownDot
+}
+
+func cornersKnown(cs ...corner) bool {
+	for _, c := range cs {
+		if !c.known() {
+			return false
+		}
+	}
+	return true
+}
+
+// dataDots are the dots of c that carry its id, ll to rr
+func (c corner) dataDots() []dot {
+	if ids != fullIDScheme {
+		return []dot{c.l, c.m, c.r}
+	}
+	return []dot{c.ll, c.l, c.m, c.r, c.rr}
 }
 
-// each dotColor stores 2 bits of info
-// one corner therefore has 10 bits of information
+// cornerIDs is the number of distinct corner ids
+func cornerIDs() uint64 {
+	digits := 3
+	if ids == fullIDScheme {
+		digits = 5
+	}
+	n := uint64(1)
+	for i := 0; i < digits; i++ {
+		n *= uint64(len(palette))
+	}
+	return n
+}
+
+// each dot is a digit in base len(palette), ll most significant.
+// With the default 4 colours, one corner therefore has 10 bits of information
 func (c corner) id() uint16 {
 	var out uint16
-	if simpleIDs {
-		out |= uint16(c.r.c)
-		out |= uint16(c.m.c) << 2
-		out |= uint16(c.l.c) << 4
-		return out
+	for _, d := range c.dataDots() {
+		out = out*uint16(len(palette)) + uint16(d.c)
 	}
-	out |= uint16(c.rr.c)
-	out |= uint16(c.r.c) << 2
-	out |= uint16(c.m.c) << 4
-	out |= uint16(c.l.c) << 6
-	out |= uint16(c.ll.c) << 8
 	return out
 }
 
-// one page has 4 corners, therefore a 40 bit unique id in theory
+// one page has 4 corners, therefore a 40 bit unique id in theory (with the default palette)
 // however, we want to still recognise a paper when one corner is covered
 // practically this means each paper has 4 unique 30 bit ids (related by a 10-bit shift)
 // this takes 2 bits out of the space of unique 30 bit pageIDs, so 2**28 remain
+// corner ids are digits in base cornerIDs(), ulhc most significant
 func pageID(ulhc, urhc, lrhc, llhc uint16) uint64 {
-	var out uint64
-	if simpleIDs {
-		out |= uint64(llhc)
-		out |= uint64(lrhc) << 6
-		out |= uint64(urhc) << 12
-		out |= uint64(ulhc) << 18
-		return out
-	}
-	out |= uint64(llhc)
-	out |= uint64(lrhc) << 10
-	out |= uint64(urhc) << 20
-	out |= uint64(ulhc) << 30
-	return out
-}
-
-func pagePartialID(x, y, z uint16) uint32 {
-	var out uint32
-	if simpleIDs {
-		out |= uint32(x)
-		out |= uint32(y) << 6
-		out |= uint32(z) << 12
-		return out
-	}
-	out |= uint32(z)
-	out |= uint32(y) << 10
-	out |= uint32(x) << 20
-	return out
+	n := cornerIDs()
+	return ((uint64(ulhc)*n+uint64(urhc))*n+uint64(lrhc))*n + uint64(llhc)
 }
 
 type dot struct {
 	p point
 	c dotColor
+	// confidence of the colour classification, in [0,1]
+	conf float64
 }
 
+// dotColor indexes the palette
 type dotColor uint8
 
-const (
-	redDot dotColor = iota
-	greenDot
-	blueDot
-	yellowDot
-)
+// unknownDot is a dot we could not confidently classify as any colour.
+// It is not part of any id: corners containing one cannot be looked up
+const unknownDot dotColor = 255
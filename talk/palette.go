@@ -0,0 +1,81 @@
+package talk
+
+import (
+	"fmt"
+	"image/color"
+)
+
+// DotColor is one of the colours dots are printed in
+type DotColor struct {
+	Name string
+	// letter for this colour in corner shorthand, see cornerShorthand
+	Shorthand byte
+	// what we print, and draw in the debug window
+	RGB color.RGBA
+}
+
+// using CIELAB color picker and comparing with reference material from dynamicland
+// red6, green7, purple8, orange6
+var DefaultPalette = []DotColor{
+	{Name: "red", Shorthand: 'r', RGB: color.RGBA{245, 34, 45, 0}},
+	{Name: "green", Shorthand: 'g', RGB: color.RGBA{56, 158, 13, 0}},
+	{Name: "blue", Shorthand: 'b', RGB: color.RGBA{57, 16, 133, 0}},
+	{Name: "yellow", Shorthand: 'y', RGB: color.RGBA{250, 140, 22, 0}},
+}
+
+// ordered: the index of a colour is its dotColor, and its digit in corner and page ids
+var palette = DefaultPalette
+
+// so that 3 corners of 5 dots each still make an id that fits in 64 bits
+const maxPaletteSize = 8
+
+// UsePalette sets the colours dots are printed in. More colours means more unique pages,
+// but colours that are closer together and so harder to tell apart.
+// Detection models are learned per colour from the calibration page, which prints the whole palette:
+// print it again and recalibrate after changing the palette
+func UsePalette(p []DotColor) error {
+	if len(p) < 2 || len(p) > maxPaletteSize {
+		return fmt.Errorf("palette needs 2 to %d colours, got %d", maxPaletteSize, len(p))
+	}
+	seen := map[byte]bool{}
+	for _, c := range p {
+		if seen[c.Shorthand] {
+			return fmt.Errorf("palette has shorthand %q more than once", c.Shorthand)
+		}
+		seen[c.Shorthand] = true
+	}
+	palette = p
+	return nil
+}
+
+func paletteRGB() []color.RGBA {
+	out := make([]color.RGBA, len(palette))
+	for i, c := range palette {
+		out[i] = c.RGB
+	}
+	return out
+}
+
+// rgb is the printed colour of c; unknown dots are drawn white
+func (c dotColor) rgb() color.RGBA {
+	if int(c) >= len(palette) {
+		return colorWhite
+	}
+	return palette[c].RGB
+}
+
+func (c dotColor) shorthand() byte {
+	if int(c) >= len(palette) {
+		return '?'
+	}
+	return palette[c].Shorthand
+}
+
+func shorthandColor(b byte) dotColor {
+	for i, c := range palette {
+		if c.Shorthand == b {
+			return dotColor(i)
+		}
+	}
+	return unknownDot
+}
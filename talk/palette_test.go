@@ -0,0 +1,115 @@
+package talk
+
+import (
+	"image/color"
+	"math/rand"
+	"testing"
+)
+
+// keepPalette restores the palette when t is done
+func keepPalette(t *testing.T) {
+	old := palette
+	t.Cleanup(func() { palette = old })
+}
+
+// testPalette has n colours with shorthands a, b, c and so on
+func testPalette(n int) []DotColor {
+	p := make([]DotColor, n)
+	for i := range p {
+		p[i] = DotColor{Name: string(rune('a' + i)), Shorthand: byte('a' + i), RGB: color.RGBA{uint8(30 * i), 0, 0, 0}}
+	}
+	return p
+}
+
+func TestUsePalette(t *testing.T) {
+	collision := testPalette(5)
+	collision[3].Shorthand = 'b'
+	for _, tt := range []struct {
+		name string
+		p    []DotColor
+		ok   bool
+	}{
+		{"default", DefaultPalette, true},
+		{"empty", nil, false},
+		{"one colour", testPalette(1), false},
+		{"two colours", testPalette(2), true},
+		{"five colours", testPalette(5), true},
+		{"most colours", testPalette(maxPaletteSize), true},
+		{"too many colours", testPalette(maxPaletteSize + 1), false},
+		{"shorthand twice", collision, false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			keepPalette(t)
+			palette = DefaultPalette
+			err := UsePalette(tt.p)
+			if (err == nil) != tt.ok {
+				t.Fatalf("got error %v, want ok %v", err, tt.ok)
+			}
+			if !tt.ok {
+				if len(palette) != len(DefaultPalette) || palette[0] != DefaultPalette[0] {
+					t.Errorf("rejected palette was used anyway")
+				}
+				return
+			}
+			for i, c := range tt.p {
+				if got := shorthandColor(c.Shorthand); got != dotColor(i) {
+					t.Errorf("shorthand %q is colour %d, want %d", c.Shorthand, got, i)
+				}
+			}
+		})
+	}
+}
+
+func TestCalibrationGrid(t *testing.T) {
+	keepPalette(t)
+	const s = calibrationSpacingCM
+	for _, tt := range []struct {
+		colors int
+		want   []point
+	}{
+		{2, []point{{0, -s / 2}, {0, s / 2}}},
+		{3, []point{{-s / 2, -s / 2}, {s / 2, -s / 2}, {0, s / 2}}},
+		// the original square
+		{4, []point{{-s / 2, -s / 2}, {s / 2, -s / 2}, {-s / 2, s / 2}, {s / 2, s / 2}}},
+		{5, []point{{-s, -s / 2}, {0, -s / 2}, {s, -s / 2}, {-s / 2, s / 2}, {s / 2, s / 2}}},
+		{8, []point{
+			{-1.5 * s, -s / 2}, {-s / 2, -s / 2}, {s / 2, -s / 2}, {1.5 * s, -s / 2},
+			{-1.5 * s, s / 2}, {-s / 2, s / 2}, {s / 2, s / 2}, {1.5 * s, s / 2},
+		}},
+	} {
+		palette = testPalette(tt.colors)
+		got := calibrationGrid()
+		if len(got) != len(tt.want) {
+			t.Errorf("%d colours: grid of %d dots", tt.colors, len(got))
+			continue
+		}
+		for i := range got {
+			if !closeTo(got[i], tt.want[i], 1e-9) {
+				t.Errorf("%d colours: colour %d at %v, want %v", tt.colors, i, got[i], tt.want[i])
+			}
+		}
+
+		// as seen on the calibration page, in any order
+		circles := make([]circle, len(got))
+		for i, p := range got {
+			circles[i] = circle{mid: p.mul(10).add(point{300, 200})}
+		}
+		rand.New(rand.NewSource(int64(tt.colors))).Shuffle(len(circles), func(i, j int) {
+			circles[i], circles[j] = circles[j], circles[i]
+		})
+		sortCirclesAsGrid(circles, calibrationCols())
+		for i, c := range circles {
+			if want := got[i].mul(10).add(point{300, 200}); c.mid != want {
+				t.Errorf("%d colours: sorted dot %d at %v, want colour %d at %v", tt.colors, i, c.mid, i, want)
+			}
+		}
+		if c := calibrationCenter(circles); !closeTo(c, point{300, 200}, 1e-9) {
+			t.Errorf("%d colours: centre at %v, want the middle of the page", tt.colors, c)
+		}
+		for _, d := range calibrationDistances(circles) {
+			if d != s*10 {
+				t.Errorf("%d colours: neighbours %v apart, want %v", tt.colors, d, s*10)
+			}
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package talk
+
+import (
+	"image"
+	"math"
+	"sort"
+)
+
+// partition divides a frame into overlapping square cells, at a few scales, to group
+// circles into candidate corners. Each level is meant for corners of a certain size:
+// the bounding box of their dot centres. At each level cells overlap such that
+// their cores (the middle stride x stride of each cell) tile the frame, and a corner
+// of that size centered in a core fits in its cell completely.
+// This means each corner is owned by exactly one cell, see owns.
+type partition struct {
+	cells  map[image.Rectangle][]circle
+	levels []partitionLevel
+}
+
+type partitionLevel struct {
+	// largest corner this level is for; the smallest is the maxSize of the level below
+	maxSize float64
+	stride  int
+	size    int
+}
+
+// dot centres of a corner span 5cm along each arm, so at most 5*sqrt(2) across when rotated 45 degrees
+const cornerSizeCM = 7.1
+
+// newPartition sets up levels for corners from half to double the size we expect at pixelsPerCM,
+// so pages closer to or further from the camera still group.
+// Without pixelsPerCM, i.e. before calibration, there is one level tuned for a 1280x720 webcam.
+func newPartition(pixelsPerCM float64) partition {
+	pt := partition{cells: map[image.Rectangle][]circle{}}
+	if pixelsPerCM == 0 {
+		// used to be 130px squares with a stride of 65 on a 1280x720 webcam, here scaled to the straightened image
+		size := 130. * STRAIGHT_W / WEBCAM_WIDTH
+		pt.levels = []partitionLevel{newPartitionLevel(size / 1.5)}
+		return pt
+	}
+	expected := cornerSizeCM * pixelsPerCM
+	for _, scale := range []float64{0.5, 1, 2} {
+		// expected corner size sits in the middle of the band of its level
+		pt.levels = append(pt.levels, newPartitionLevel(expected*scale*math.Sqrt2))
+	}
+	return pt
+}
+
+func newPartitionLevel(maxSize float64) partitionLevel {
+	b := int(math.Ceil(maxSize))
+	stride := (b + 1) / 2
+	return partitionLevel{maxSize: maxSize, stride: stride, size: b + stride}
+}
+
+// add puts a circle in every cell containing its centre
+func (pt partition) add(c circle) {
+	for _, lvl := range pt.levels {
+		s := float64(lvl.stride)
+		// cell ix spans [ix*stride, ix*stride+size)
+		minX := int(math.Floor((c.mid.x-float64(lvl.size))/s)) + 1
+		maxX := int(math.Floor(c.mid.x / s))
+		minY := int(math.Floor((c.mid.y-float64(lvl.size))/s)) + 1
+		maxY := int(math.Floor(c.mid.y / s))
+		for ix := minX; ix <= maxX; ix++ {
+			for iy := minY; iy <= maxY; iy++ {
+				min := image.Pt(ix*lvl.stride, iy*lvl.stride)
+				cell := image.Rectangle{min, min.Add(image.Pt(lvl.size, lvl.size))}
+				pt.cells[cell] = append(pt.cells[cell], c)
+			}
+		}
+	}
+}
+
+// owns reports whether cell is the one cell responsible for recognising c
+func (pt partition) owns(cell image.Rectangle, c corner) bool {
+	i := sort.Search(len(pt.levels), func(i int) bool {
+		return pt.levels[i].size >= cell.Dx()
+	})
+	if i == len(pt.levels) || pt.levels[i].size != cell.Dx() {
+		return false
+	}
+	lvl := pt.levels[i]
+
+	pts := []point{c.ll.p, c.l.p, c.m.p, c.r.p, c.rr.p}
+	bbMin, bbMax := pts[0], pts[0]
+	for _, p := range pts[1:] {
+		bbMin = point{math.Min(bbMin.x, p.x), math.Min(bbMin.y, p.y)}
+		bbMax = point{math.Max(bbMax.x, p.x), math.Max(bbMax.y, p.y)}
+	}
+	// corners too big for the largest cells dont fit anywhere
+	size := math.Max(bbMax.x-bbMin.x, bbMax.y-bbMin.y)
+	if size > lvl.maxSize || (i > 0 && size <= pt.levels[i-1].maxSize) {
+		return false
+	}
+
+	center := bbMin.add(bbMax).div(2)
+	offset := float64(lvl.size-lvl.stride) / 2.
+	coreMin := point{float64(cell.Min.X) + offset, float64(cell.Min.Y) + offset}
+	coreMax := coreMin.add(point{float64(lvl.stride), float64(lvl.stride)})
+	return center.x >= coreMin.x && center.x < coreMax.x && center.y >= coreMin.y && center.y < coreMax.y
+}
@@ -0,0 +1,79 @@
+package talk
+
+import (
+	"math"
+	"testing"
+)
+
+// testCorner has its top at m and arms of armPixels pointing at angle and a quarter turn further
+func testCorner(m point, angle, armPixels float64) corner {
+	right := point{math.Cos(angle), math.Sin(angle)}.mul(armPixels)
+	left := point{-math.Sin(angle), math.Cos(angle)}.mul(armPixels)
+	return corner{
+		ll: dot{p: m.add(left)},
+		l:  dot{p: m.add(left.div(2))},
+		m:  dot{p: m},
+		r:  dot{p: m.add(right.div(2))},
+		rr: dot{p: m.add(right)},
+	}
+}
+
+// owners are the cells that see all dots of c and own it
+func owners(pt partition, c corner) int {
+	n := 0
+	for cell, cs := range pt.cells {
+		if len(cs) == 5 && pt.owns(cell, c) {
+			n++
+		}
+	}
+	return n
+}
+
+func TestPartitionOwnsEachCornerOnce(t *testing.T) {
+	const pixelsPerCM = 10.
+	// the arms of a printed corner are 5cm
+	for _, scale := range []float64{0.4, 0.7, 1, 1.5, 2.5} {
+		for _, angle := range []float64{0, 0.3, math.Pi / 4, 2, 4} {
+			for _, m := range []point{{100, 100}, {233.3, 151.7}, {400, 50}} {
+				pt := newPartition(pixelsPerCM)
+				c := testCorner(m, angle, 5*scale*pixelsPerCM)
+				for _, d := range []dot{c.ll, c.l, c.m, c.r, c.rr} {
+					pt.add(circle{mid: d.p})
+				}
+				if n := owners(pt, c); n != 1 {
+					t.Errorf("corner at %v, angle %.2f, scale %.1f owned by %d cells, want 1", m, angle, scale, n)
+				}
+			}
+		}
+	}
+}
+
+func TestPartitionOwnsNoCornerTooBig(t *testing.T) {
+	pt := newPartition(10)
+	c := testCorner(point{300, 160}, 0, 5*5*10)
+	for _, d := range []dot{c.ll, c.l, c.m, c.r, c.rr} {
+		pt.add(circle{mid: d.p})
+	}
+	for cell := range pt.cells {
+		if pt.owns(cell, c) {
+			t.Fatalf("cell %v owns a corner bigger than any level is for", cell)
+		}
+	}
+}
+
+func TestPartitionOwnsOnlyAtItsLevel(t *testing.T) {
+	pt := newPartition(10)
+	// a corner the size expected at pixelsPerCM belongs to the middle level: at 45 degrees it is cornerSizeCM across
+	c := testCorner(point{300, 160}, math.Pi/4, 5*10)
+	for _, d := range []dot{c.ll, c.l, c.m, c.r, c.rr} {
+		pt.add(circle{mid: d.p})
+	}
+	for cell := range pt.cells {
+		if pt.owns(cell, c) && cell.Dx() != pt.levels[1].size {
+			t.Errorf("cell %v of size %d owns a corner of the level with cells of size %d", cell, cell.Dx(), pt.levels[1].size)
+		}
+	}
+	if owners(pt, c) != 1 {
+		t.Errorf("corner owned by %d cells, want 1", owners(pt, c))
+	}
+}
@@ -0,0 +1,179 @@
+package talk
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+)
+
+const calibrationFile = "calibration.json"
+
+// calibrationResults are stored next to calibration.json
+const calibrationResultsFile = "calibration_results.json"
+
+// bump whenever the fields in the results file change meaning
+const calibrationResultsVersion = 5
+
+var forceCalibration bool
+
+// ForceCalibration ignores saved calibration results and runs interactive calibration on startup
+func ForceCalibration() {
+	forceCalibration = true
+}
+
+func calibrationResultsPath() string {
+	return filepath.Join(filepath.Dir(calibrationFile), calibrationResultsFile)
+}
+
+func (cr calibrationResults) MarshalJSON() ([]byte, error) {
+	return json.MarshalIndent(struct {
+		Version         int
+		Webcam          string
+		Beamer          string
+		PixelsPerCM     float64
+		Displacement    []float64
+		DisplayRatio    float64
+		ReferenceColors []color.RGBA
+		ColorModels     [][]float64
+		Histograms      [][]float64 `json:",omitempty"`
+		Homography      []float64   `json:",omitempty"`
+	}{
+		Version:         calibrationResultsVersion,
+		Webcam:          sizeToString(cr.webcamSize),
+		Beamer:          sizeToString(cr.beamerSize),
+		PixelsPerCM:     cr.pixelsPerCM,
+		Displacement:    []float64{cr.displacement.x, cr.displacement.y},
+		DisplayRatio:    cr.displayRatio,
+		ReferenceColors: cr.referenceColors,
+		ColorModels:     colorModelsToSlices(cr.colorModels),
+		Histograms:      float32sToFloat64s(matsToFloatSlice32F(cr.histograms)),
+		Homography:      cr.homography,
+	}, "", "  ")
+}
+
+func (cr *calibrationResults) UnMarshalJSON(data []byte) error {
+	aux := struct {
+		Version         int
+		Webcam          string
+		Beamer          string
+		PixelsPerCM     float64
+		Displacement    []float64
+		DisplayRatio    float64
+		ReferenceColors []color.RGBA
+		ColorModels     [][]float64
+		Histograms      [][]float64
+		Homography      []float64
+	}{}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	if aux.Version != calibrationResultsVersion {
+		return fmt.Errorf("calibration results version %d, expected %d", aux.Version, calibrationResultsVersion)
+	}
+	if len(aux.Displacement) != 2 {
+		return fmt.Errorf("invalid displacement %v", aux.Displacement)
+	}
+	cr.webcamSize = stringToSize(aux.Webcam)
+	cr.beamerSize = stringToSize(aux.Beamer)
+	cr.pixelsPerCM = aux.PixelsPerCM
+	cr.displacement = point{aux.Displacement[0], aux.Displacement[1]}
+	cr.displayRatio = aux.DisplayRatio
+	cr.referenceColors = aux.ReferenceColors
+	models, err := slicesToColorModels(aux.ColorModels)
+	if err != nil {
+		return err
+	}
+	cr.colorModels = models
+	// only there after calibrating with histograms, one per palette colour
+	if len(aux.Histograms) > 0 {
+		if len(aux.Histograms) != len(aux.ReferenceColors) {
+			return fmt.Errorf("%d histograms for %d colours", len(aux.Histograms), len(aux.ReferenceColors))
+		}
+		sizes := []int{HIST_SIZE, HIST_SIZE, HIST_SIZE}
+		cr.histograms, err = floatToMats32F(aux.Histograms, sizes, len(aux.Histograms))
+		if err != nil {
+			return err
+		}
+	}
+	if aux.Homography != nil {
+		if len(aux.Homography) != 9 {
+			return fmt.Errorf("invalid homography %v", aux.Homography)
+		}
+		cr.homography = aux.Homography
+	}
+	return nil
+}
+
+func saveCalibrationResults(file string, cr calibrationResults) error {
+	b, err := cr.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, b, 0644)
+}
+
+// loadCalibrationResults rejects results taken at another webcam or beamer resolution than the current one,
+// or for another number of colours
+func loadCalibrationResults(file string, webcamSize image.Point) (calibrationResults, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return calibrationResults{}, err
+	}
+	cr := calibrationResults{}
+	if err := cr.UnMarshalJSON(b); err != nil {
+		cr.Close()
+		return calibrationResults{}, err
+	}
+	if err := cr.current(webcamSize); err != nil {
+		cr.Close()
+		return calibrationResults{}, err
+	}
+	return cr, nil
+}
+
+// current checks cr was taken at the current webcam and beamer resolution, with the current palette
+func (cr calibrationResults) current(webcamSize image.Point) error {
+	if cr.webcamSize != webcamSize {
+		return fmt.Errorf("stale calibration results: webcam resolution was %v, now %v", cr.webcamSize, webcamSize)
+	}
+	if beamerSize := image.Pt(beamerWidth, beamerHeight); cr.beamerSize != beamerSize {
+		return fmt.Errorf("stale calibration results: beamer resolution was %v, now %v", cr.beamerSize, beamerSize)
+	}
+	if len(cr.referenceColors) != len(palette) {
+		return fmt.Errorf("stale calibration results: calibrated %d colours, palette has %d", len(cr.referenceColors), len(palette))
+	}
+	return nil
+}
+
+func sizeToString(p image.Point) string {
+	return fmt.Sprintf("%dx%d", p.X, p.Y)
+}
+
+func stringToSize(s string) image.Point {
+	var p image.Point
+	fmt.Sscanf(s, "%dx%d", &p.X, &p.Y)
+	return p
+}
+
+// each colour model is stored as its lab mean followed by its variance
+func colorModelsToSlices(models []colorModel) [][]float64 {
+	out := make([][]float64, len(models))
+	for i, m := range models {
+		out[i] = []float64{m.mean.l, m.mean.a, m.mean.b, m.variance.l, m.variance.a, m.variance.b}
+	}
+	return out
+}
+
+func slicesToColorModels(data [][]float64) ([]colorModel, error) {
+	models := make([]colorModel, len(data))
+	for i, d := range data {
+		if len(d) != 6 {
+			return nil, fmt.Errorf("invalid colour model %v", d)
+		}
+		models[i] = colorModel{mean: lab{d[0], d[1], d[2]}, variance: lab{d[3], d[4], d[5]}}
+	}
+	return models, nil
+}
@@ -0,0 +1,95 @@
+package talk
+
+import (
+	"encoding/json"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func testCalibrationResults() calibrationResults {
+	return calibrationResults{
+		pixelsPerCM:     12.5,
+		displacement:    point{-3.25, 7},
+		displayRatio:    0.8,
+		referenceColors: []color.RGBA{{200, 30, 30, 0}, {30, 150, 30, 0}, {30, 30, 200, 0}, {200, 170, 0, 0}},
+		colorModels: []colorModel{
+			{mean: lab{50, 60, 40}, variance: lab{10, 20, 30}},
+			{mean: lab{55, -50, 45}, variance: lab{11, 21, 31}},
+			{mean: lab{30, 40, -70}, variance: lab{12, 22, 32}},
+			{mean: lab{70, 20, 70}, variance: lab{13, 23, 33}},
+		},
+		homography: homography{2, 0, 10, 0, 2, 20, 0, 0, 1},
+		webcamSize: image.Pt(1280, 720),
+		beamerSize: image.Pt(beamerWidth, beamerHeight),
+	}
+}
+
+func TestCalibrationResultsRoundTrip(t *testing.T) {
+	file := filepath.Join(t.TempDir(), calibrationResultsFile)
+	want := testCalibrationResults()
+	if err := saveCalibrationResults(file, want); err != nil {
+		t.Fatal(err)
+	}
+	got, err := loadCalibrationResults(file, want.webcamSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("loaded %+v, saved %+v", got, want)
+	}
+}
+
+// editResults saves cr to a file, changes field to v in the saved json and returns the file
+func editResults(t *testing.T, cr calibrationResults, field string, v any) string {
+	t.Helper()
+	b, err := cr.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := map[string]any{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		t.Fatal(err)
+	}
+	m[field] = v
+	if b, err = json.Marshal(m); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(t.TempDir(), calibrationResultsFile)
+	if err := os.WriteFile(file, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestCalibrationResultsRejectsStale(t *testing.T) {
+	cr := testCalibrationResults()
+	for _, tt := range []struct {
+		name  string
+		field string
+		v     any
+	}{
+		{"other webcam resolution", "Webcam", "640x480"},
+		{"other beamer resolution", "Beamer", "1920x1080"},
+		{"older version", "Version", calibrationResultsVersion - 1},
+		{"other number of colours", "ReferenceColors", cr.referenceColors[:3]},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			file := editResults(t, cr, tt.field, tt.v)
+			if _, err := loadCalibrationResults(file, cr.webcamSize); err == nil {
+				t.Errorf("loaded results with %s %v", tt.field, tt.v)
+			}
+		})
+	}
+	// and as saved, with the webcam at another resolution than now
+	file := filepath.Join(t.TempDir(), calibrationResultsFile)
+	if err := saveCalibrationResults(file, cr); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadCalibrationResults(file, image.Pt(640, 480)); err == nil {
+		t.Errorf("loaded results taken at %v while the webcam is 640x480", cr.webcamSize)
+	}
+}
@@ -0,0 +1,285 @@
+package talk
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"sync"
+	"time"
+
+	"github.com/deosjr/elephanttalk/opencv"
+	"gocv.io/x/gocv"
+)
+
+// frameloop runs as a pipeline of stages, each on its own goroutine except render,
+// since windows want to be drawn from the main one:
+//
+//	capture -> detect -> evaluate -> render
+//
+// Stages are connected by channels holding one frame. Capture and detect never wait for the
+// stage after them: if that stage is still busy, the frame waiting for it is dropped in favour
+// of the newer one. This way a slow page script lowers the FPS of what is projected,
+// not that of the camera. Evaluate does wait for render, so we never evaluate frames nobody sees.
+// When the source runs out, capture closes its channel and each stage passes on what it still
+// has before closing its own: the last frames of a video are shown before frameloop returns.
+
+var lockstep bool
+
+// UseLockstepPipeline makes every frame go through all stages: capture waits for detect
+// instead of dropping frames. Use this for video files and image directories, which unlike
+// a webcam dont produce frames in real time
+func UseLockstepPipeline() {
+	lockstep = true
+}
+
+// frame is what travels through the pipeline
+type frame struct {
+	captured time.Time
+	// straightened webcam frame after detect; callbacks draw debug info in it
+	img gocv.Mat
+	// copy of img before anyone drew in it, and the same as an image
+	clean            gocv.Mat
+	actualImage      image.Image
+	spatialPartition partition
+	// snapshot of the projection after evaluate
+	cimg gocv.Mat
+	// owns all mats above, and whatever lisp creates while evaluating this frame
+	arena *opencv.Arena
+}
+
+func (f *frame) close() {
+	f.arena.Release()
+}
+
+// stageStats keeps moving averages of throughput and latency of a stage
+type stageStats struct {
+	mu      sync.Mutex
+	name    string
+	fps     float64
+	latency time.Duration
+	last    time.Time
+	dropped int
+}
+
+// weight of the newest frame in the moving averages
+const statsAlpha = 0.1
+
+func (s *stageStats) done(start time.Time) {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	latency := now.Sub(start)
+	if s.last.IsZero() {
+		s.latency = latency
+	} else {
+		fps := float64(time.Second) / float64(now.Sub(s.last))
+		s.fps += statsAlpha * (fps - s.fps)
+		s.latency += time.Duration(statsAlpha * float64(latency-s.latency))
+	}
+	s.last = now
+}
+
+func (s *stageStats) drop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dropped++
+}
+
+func (s *stageStats) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return fmt.Sprintf("%s: %.0f fps %.1f ms, %d dropped", s.name, s.fps, float64(s.latency)/float64(time.Millisecond), s.dropped)
+}
+
+type pipelineStats struct {
+	capture, detect, evaluate, render stageStats
+	// from capture until shown
+	total stageStats
+}
+
+func newPipelineStats() *pipelineStats {
+	return &pipelineStats{
+		capture:  stageStats{name: "capture"},
+		detect:   stageStats{name: "detect"},
+		evaluate: stageStats{name: "evaluate"},
+		render:   stageStats{name: "render"},
+		total:    stageStats{name: "total"},
+	}
+}
+
+func (ps *pipelineStats) draw(img *gocv.Mat) {
+	for i, s := range []*stageStats{&ps.capture, &ps.detect, &ps.evaluate, &ps.render, &ps.total} {
+		gocv.PutText(img, s.String(), image.Pt(0, 20+15*i), 0, .4, color.RGBA{}, 1)
+	}
+	// frames in flight hold a few each; if this keeps growing, something isnt released
+	live := fmt.Sprintf("native objects: %d live", opencv.Stats().Live())
+	gocv.PutText(img, live, image.Pt(0, 20+15*5), 0, .4, color.RGBA{}, 1)
+}
+
+// handOff passes f to the next stage. Unless in lockstep, it doesnt wait for that stage:
+// a frame still waiting for it is dropped instead, counted against next.
+// Returns false if the pipeline was stopped before f could be passed on.
+func handOff(ch chan *frame, f *frame, next *stageStats, done chan struct{}) bool {
+	if lockstep {
+		select {
+		case ch <- f:
+			return true
+		case <-done:
+			f.close()
+			return false
+		}
+	}
+	for {
+		select {
+		case ch <- f:
+			return true
+		default:
+		}
+		// we are the only sender, so after this there is room
+		select {
+		case old := <-ch:
+			old.close()
+			next.drop()
+		default:
+		}
+	}
+}
+
+// frameloop runs f on each frame until a key is pressed, and returns that key.
+// f gets the straightened frame to draw debug info in, and a clean copy and snapshot of it;
+// it runs on the evaluate goroutine, which is the only one touching fi.cimg until frameloop returns
+func frameloop(fi frameInput, f func(gocv.Mat, gocv.Mat, image.Image, partition), ref []color.RGBA, waitMillis int) (int, error) {
+	stats := newPipelineStats()
+	captured := make(chan *frame, 1)
+	detected := make(chan *frame, 1)
+	evaluated := make(chan *frame, 1)
+	errc := make(chan error, 1)
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(3)
+
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			start := time.Now()
+			arena := opencv.NewArena()
+			img := arena.Mat(gocv.NewMat())
+			if ok := fi.webcam.Read(&img); !ok {
+				arena.Release()
+				errc <- fmt.Errorf("cannot read device\n")
+				close(captured)
+				return
+			}
+			if img.Empty() {
+				arena.Release()
+				continue
+			}
+			stats.capture.done(start)
+			if !handOff(captured, &frame{captured: start, img: img, arena: arena}, &stats.detect, done) {
+				return
+			}
+		}
+	}()
+
+	go func() {
+		defer wg.Done()
+		for {
+			var fr *frame
+			var ok bool
+			select {
+			case <-done:
+				return
+			case fr, ok = <-captured:
+			}
+			if !ok {
+				close(detected)
+				return
+			}
+			start := time.Now()
+			// all detection happens in straightened space, so we replace the raw frame
+			// positions of detected circles and their sampled colours then line up,
+			// and callbacks drawing debug info in img draw on what is shown
+			fr.img = fr.arena.Mat(beamerToChessboard(fr.img, fi.scChsBrd))
+
+			// since detect draws in img, we take a copy and a snapshot first
+			fr.clean = fr.arena.Mat(fr.img.Clone())
+			actualImage, err := fr.img.ToImage()
+			if err != nil {
+				fmt.Println(err)
+				fr.close()
+				continue
+			}
+			fr.actualImage = actualImage
+			fr.spatialPartition = detect(fr.img, fr.actualImage, ref, fi.histograms, fi.scChsBrd.Csf, fi.pixelsPerCM)
+			stats.detect.done(start)
+			if !handOff(detected, fr, &stats.evaluate, done) {
+				return
+			}
+		}
+	}()
+
+	go func() {
+		defer wg.Done()
+		for {
+			var fr *frame
+			var ok bool
+			select {
+			case <-done:
+				return
+			case fr, ok = <-detected:
+			}
+			if !ok {
+				close(evaluated)
+				return
+			}
+			start := time.Now()
+			opencv.UseArena(fr.arena)
+			f(fr.img, fr.clean, fr.actualImage, fr.spatialPartition)
+			fr.cimg = fr.arena.Mat(fi.cimg.Clone())
+			stats.evaluate.done(start)
+			select {
+			case evaluated <- fr:
+			case <-done:
+				fr.close()
+				return
+			}
+		}
+	}()
+
+	stop := func() {
+		close(done)
+		wg.Wait()
+		for _, ch := range []chan *frame{captured, detected, evaluated} {
+			select {
+			case fr, ok := <-ch:
+				if ok {
+					fr.close()
+				}
+			default:
+			}
+		}
+	}
+
+	for fr := range evaluated {
+		start := time.Now()
+		stats.draw(&fr.img)
+		fi.debugWindow.Show(fr.img)
+		fi.projection.Show(fr.cimg)
+		key := fi.keys.WaitKey(waitMillis)
+		fr.close()
+		stats.render.done(start)
+		stats.total.done(fr.captured)
+		if key >= 0 {
+			stop()
+			return key, nil
+		}
+	}
+	// all stages are done and closed their channels, so capture has told us why
+	stop()
+	return -1, <-errc
+}
@@ -0,0 +1,46 @@
+package talk
+
+import (
+	"image"
+	"testing"
+
+	"gocv.io/x/gocv"
+)
+
+func TestLockstepEvaluatesLastFramesBeforeEOF(t *testing.T) {
+	lockstep = true
+	defer func() { lockstep = false }()
+
+	sc := identityChessboard()
+	defer sc.MapX.Close()
+	defer sc.MapY.Close()
+	defer sc.M.Close()
+	img := gocv.NewMat()
+	defer img.Close()
+	cimg := gocv.NewMatWithSize(beamerHeight, beamerWidth, gocv.MatTypeCV8UC3)
+	defer cimg.Close()
+
+	debug := NewMemorySink(0)
+	fi := frameInput{
+		webcam:      grayFrames(4),
+		debugWindow: debug,
+		projection:  NewMemorySink(1),
+		// never pressed before the frames run out
+		keys:     ScriptedKeys(100),
+		img:      img,
+		cimg:     cimg,
+		scChsBrd: sc,
+	}
+	evaluated := 0
+	key, err := frameloop(fi, func(gocv.Mat, gocv.Mat, image.Image, partition) { evaluated++ }, nil, 1)
+	if err == nil || key >= 0 {
+		t.Fatalf("got key %d and error %v, want the source to run out", key, err)
+	}
+	if evaluated != 4 || len(debug.Frames) != 4 {
+		t.Fatalf("evaluated %d and showed %d frames, want all 4", evaluated, len(debug.Frames))
+	}
+	r, _, _, _ := debug.Last().At(STRAIGHT_W/2, STRAIGHT_H/2).RGBA()
+	if r>>8 != 40 {
+		t.Errorf("last frame shown has gray %d, want that of the last frame read", r>>8)
+	}
+}
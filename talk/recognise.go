@@ -0,0 +1,293 @@
+package talk
+
+import (
+	"image/color"
+	"math"
+
+	"gocv.io/x/gocv"
+)
+
+// pageRecognizer turns a frame into the pages recognised in it, one for each physical copy.
+// The m dot of each corner is where its corner top is seen, in straightened webcamspace.
+// img is the frame to draw debug info in; clean is a copy of that frame before anyone drew in it
+type pageRecognizer interface {
+	recognise(img, clean gocv.Mat, spatialPartition partition) []page
+}
+
+// dotRecognizer finds pages by the coloured dots in their corners, see detect.go
+type dotRecognizer struct {
+	classifier colorClassifier
+	// to correct the colours of corners close to where we expect a page
+	tracker *pageTracker
+	// in straightened space
+	pixelsPerCM float64
+}
+
+func (dr dotRecognizer) recognise(img, _ gocv.Mat, spatialPartition partition) []page {
+	red := color.RGBA{255, 0, 0, 0}
+	blue := color.RGBA{0, 0, 255, 0}
+
+	corners := []corner{}
+
+	// find corners
+	for _, cc := range findAllCorners(spatialPartition, dr.classifier) {
+		corner := cc.corner
+		gocv.Rectangle(&img, cc.cell, red, 2)
+		gocv.Line(&img, corner.m.p.toIntPt(), corner.ll.p.toIntPt(), blue, 2)
+		gocv.Line(&img, corner.m.p.toIntPt(), corner.rr.p.toIntPt(), blue, 2)
+
+		// unknown dots are drawn white
+		for _, d := range []dot{corner.ll, corner.l, corner.m, corner.r, corner.rr} {
+			gocv.Circle(&img, d.p.toIntPt(), 8, d.c.rgb(), -1)
+		}
+
+		corners = append(corners, corner)
+	}
+
+	// attempt to update corners if their colors dont match a corner we expect close to it
+	// tracked corners are guaranteed to have matched an existing page
+	expected := dr.tracker.expectedCorners(dotFiducial)
+	matchDist := trackerConfig.MatchCM * dr.pixelsPerCM
+	for i, c := range corners {
+		for _, o := range expected {
+			if euclidian(c.m.p.sub(o.m.p)) < matchDist {
+				corners[i] = corner{
+					ll: dot{p: c.ll.p, c: o.ll.c},
+					l:  dot{p: c.l.p, c: o.l.c},
+					m:  dot{p: c.m.p, c: o.m.c},
+					r:  dot{p: c.r.p, c: o.r.c},
+					rr: dot{p: c.rr.p, c: o.rr.c},
+				}
+				break
+			}
+		}
+	}
+
+	cornersClockwise := map[corner]corner{}
+	cornersCounterClockwise := map[corner]corner{}
+	// try to find another corner: the one clockwise in order that would form a page
+	// it lies along the right arm, at most the long side of a page away
+	index := newCornerIndex(corners, cornerIndexCM*dr.pixelsPerCM)
+	maxDist := pageSearchCM * dr.pixelsPerCM
+	for _, c := range corners {
+		for _, o := range index.alongRay(c.m.p, c.rr.p.sub(c.m.p), maxDist) {
+			if c.m.p == o.m.p {
+				continue
+			}
+			right := c.rr.p.sub(c.m.p)
+			toO := o.m.p.sub(c.m.p)
+			angle1 := angleBetween(right, toO)
+			if angle1 > 0.05 {
+				continue
+			}
+			left := o.ll.p.sub(o.m.p)
+			toC := c.m.p.sub(o.m.p)
+			angle2 := angleBetween(left, toC)
+			if angle2 > 0.05 {
+				continue
+			}
+			prev, ok := cornersClockwise[c]
+			if ok {
+				// overwrite previously found corner if this one is closer
+				if euclidian(c.m.p.sub(prev.m.p)) > euclidian(c.m.p.sub(o.m.p)) {
+					cornersClockwise[c] = o
+					cornersCounterClockwise[o] = c
+				}
+			} else {
+				cornersClockwise[c] = o
+				cornersCounterClockwise[o] = c
+			}
+		}
+	}
+
+	// corners without a neighbour on either side, which might be opposite one another
+	lone := []corner{}
+	for _, c := range corners {
+		_, cw := cornersClockwise[c]
+		_, ccw := cornersCounterClockwise[c]
+		if !cw && !ccw {
+			lone = append(lone, c)
+		}
+	}
+
+	// parse corners into pages
+	pages := []page{}
+	// corners can only be part of one page: this is how we know a copy of a page is another one,
+	// while all chains of 4 corners starting at each of them find the same page
+	used := map[corner]bool{}
+	taken := func(cs ...corner) bool {
+		for _, c := range cs {
+			if used[c] {
+				return true
+			}
+		}
+		return false
+	}
+	take := func(p page, cs ...corner) {
+		for _, c := range cs {
+			used[c] = true
+		}
+		pages = append(pages, p)
+	}
+	for len(corners) > 0 {
+		c := corners[0]
+		next, hasNext := cornersClockwise[c]
+		corners = corners[1:]
+
+		cs := []corner{c, next}
+		// only picking potential pages, those with at least 3 corners recognised
+		for i := 0; i < 3; i++ {
+			n, ok := cornersClockwise[next]
+			if !ok {
+				break
+			}
+			cs = append(cs, n)
+			c, next = next, n
+		}
+		if len(cs) == 2 {
+			// two adjacent corners, unless we are in the middle of a longer chain we parse from its start
+			_, hasPrev := cornersCounterClockwise[cs[0]]
+			if !twoCornerIDs || !hasNext || hasPrev {
+				continue
+			}
+			v, ok := lookupView(adjacentDB, cs)
+			if !ok || taken(cs...) {
+				continue
+			}
+			all := completeAdjacent(cs[0], cs[1], v.first)
+			if all == nil {
+				continue
+			}
+			take(placePage(v.page, v.first, all), cs...)
+			continue
+		}
+		if !(len(cs) == 3) && !(len(cs) == 5 && cs[0].m.p == cs[4].m.p) {
+			// either we have 3 corners, or we have 5 since the last one is guaranteed to point at the first
+			continue
+		}
+		// because cs[0] = cs[4], remove one instance of that corner
+		if len(cs) == 5 {
+			cs = cs[:4]
+		}
+		if taken(cs...) {
+			continue
+		}
+		detected := cs
+
+		// if we detect four corners but one is wrong, we should attempt getting page from other configurations
+		// if we detect only three, we attempt to find by those 3 corners only
+		var p page
+		// which corner of p cs[0] is
+		var first int
+		if len(cs) == 3 {
+			v, ok := lookupPage(cs)
+			if !ok {
+				continue
+			}
+			p, first = v.page, v.first
+			cs = append(cs, missingCorner(cs))
+		} else if len(cs) == 4 {
+			found := false
+			for i := 0; i < 4; i++ {
+				cs = []corner{cs[1], cs[2], cs[3], cs[0]}
+				v, ok := lookupPage(cs[:3])
+				if !ok {
+					continue
+				}
+				p, first = v.page, v.first
+				found = true
+				break
+			}
+			if !found {
+				continue
+			}
+		}
+		take(placePage(p, first, cs), detected...)
+	}
+
+	if !twoCornerIDs {
+		return pages
+	}
+	for i, c := range lone {
+		for _, o := range lone[i+1:] {
+			even, odd := diagonalPair(c, o, dr.pixelsPerCM)
+			if !even && !odd {
+				continue
+			}
+			// both orders are registered, so the pair is found whichever corner c is
+			v, ok := lookupView(diagonalDB, []corner{c, o})
+			if !ok || (v.first%2 == 0 && !even) || (v.first%2 == 1 && !odd) {
+				continue
+			}
+			if taken(c, o) {
+				continue
+			}
+			take(placePage(v.page, v.first, completeDiagonal(c, o, v.first)), c, o)
+		}
+	}
+	return pages
+}
+
+// placePage puts the corners of p where we see them: cs are clockwise, starting at corner first of p
+func placePage(p page, first int, cs []corner) page {
+	// order clockwise from ulhc; we know where it is even if its dots were misread
+	aligned := make([]corner, 4)
+	for i, c := range cs {
+		aligned[(i+first)%4] = c
+	}
+	// error correct colors on corners because 1 might be wrong
+	// in which case we would persist wrong corner across frames and error correction will not work
+	//p.ulhc, p.urhc, p.lrhc, p.llhc = aligned[0], aligned[1], aligned[2], aligned[3]
+	p.ulhc = corner{
+		ll: dot{p: aligned[0].ll.p, c: p.ulhc.ll.c},
+		l:  dot{p: aligned[0].l.p, c: p.ulhc.l.c},
+		m:  dot{p: aligned[0].m.p, c: p.ulhc.m.c},
+		r:  dot{p: aligned[0].r.p, c: p.ulhc.r.c},
+		rr: dot{p: aligned[0].rr.p, c: p.ulhc.rr.c},
+	}
+	p.urhc = corner{
+		ll: dot{p: aligned[1].ll.p, c: p.urhc.ll.c},
+		l:  dot{p: aligned[1].l.p, c: p.urhc.l.c},
+		m:  dot{p: aligned[1].m.p, c: p.urhc.m.c},
+		r:  dot{p: aligned[1].r.p, c: p.urhc.r.c},
+		rr: dot{p: aligned[1].rr.p, c: p.urhc.rr.c},
+	}
+	p.lrhc = corner{
+		ll: dot{p: aligned[2].ll.p, c: p.lrhc.ll.c},
+		l:  dot{p: aligned[2].l.p, c: p.lrhc.l.c},
+		m:  dot{p: aligned[2].m.p, c: p.lrhc.m.c},
+		r:  dot{p: aligned[2].r.p, c: p.lrhc.r.c},
+		rr: dot{p: aligned[2].rr.p, c: p.lrhc.rr.c},
+	}
+	p.llhc = corner{
+		ll: dot{p: aligned[3].ll.p, c: p.llhc.ll.c},
+		l:  dot{p: aligned[3].l.p, c: p.llhc.l.c},
+		m:  dot{p: aligned[3].m.p, c: p.llhc.m.c},
+		r:  dot{p: aligned[3].r.p, c: p.llhc.r.c},
+		rr: dot{p: aligned[3].rr.p, c: p.llhc.rr.c},
+	}
+	p.angle = pageAngle(p)
+	return p
+}
+
+// missingCorner completes 3 corners, clockwise, to a parallelogram.
+// Its dots mirror those of the opposite corner cs[1], with unknown colours
+func missingCorner(cs []corner) corner {
+	missingMid := cs[2].m.p.add(cs[0].m.p.sub(cs[1].m.p))
+	o := cs[1]
+	mirror := func(d dot) dot {
+		return dot{p: missingMid.sub(d.p.sub(o.m.p)), c: unknownDot}
+	}
+	return corner{ll: mirror(o.ll), l: mirror(o.l), m: mirror(o.m), r: mirror(o.r), rr: mirror(o.rr)}
+}
+
+// pageAngle is the rotation of p in [0,2pi), read from the right arm of its ulhc
+func pageAngle(p page) float64 {
+	rightArm := p.ulhc.rr.p.sub(p.ulhc.m.p)
+	rightAbs := p.ulhc.m.p.add(point{100, 0}).sub(p.ulhc.m.p)
+	angle := angleBetween(rightArm, rightAbs)
+	if p.ulhc.rr.p.y < p.ulhc.m.p.y {
+		angle = 2*math.Pi - angle
+	}
+	return angle
+}
@@ -0,0 +1,160 @@
+package talk
+
+import (
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+
+	"gocv.io/x/gocv"
+)
+
+// RenderSink is where the frameloop sends its output each frame.
+// There is one for the debug image and one for the projector canvas.
+type RenderSink interface {
+	Show(gocv.Mat)
+	Close() error
+}
+
+// KeySource decides when a frameloop ends; each stage of calibration
+// and the main vision loop run until WaitKey returns a key >= 0
+type KeySource interface {
+	WaitKey(millis int) int
+}
+
+var (
+	debugSink, projectorSink RenderSink
+	keySource                KeySource
+)
+
+// UseRenderSinks replaces the default HighGUI windows for debug and projector output
+func UseRenderSinks(debug, projector RenderSink) {
+	debugSink, projectorSink = debug, projector
+}
+
+// UseKeySource replaces keypresses in the debug window, i.e. for headless runs
+func UseKeySource(keys KeySource) {
+	keySource = keys
+}
+
+// windowSink shows frames in a HighGUI window and reads keypresses from it
+type windowSink struct {
+	window *gocv.Window
+}
+
+func WindowSink(name string) RenderSink {
+	return windowSink{window: gocv.NewWindow(name)}
+}
+
+func (s windowSink) Show(img gocv.Mat) {
+	s.window.IMShow(img)
+}
+
+func (s windowSink) WaitKey(millis int) int {
+	return s.window.WaitKey(millis)
+}
+
+func (s windowSink) Close() error {
+	return s.window.Close()
+}
+
+// pngSequenceSink writes each frame to dir as a numbered png: prefix00000.png, prefix00001.png, ...
+type pngSequenceSink struct {
+	dir    string
+	prefix string
+	frame  int
+}
+
+func PNGSequenceSink(dir, prefix string) (RenderSink, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &pngSequenceSink{dir: dir, prefix: prefix}, nil
+}
+
+func (s *pngSequenceSink) Show(img gocv.Mat) {
+	name := filepath.Join(s.dir, fmt.Sprintf("%s%05d.png", s.prefix, s.frame))
+	if ok := gocv.IMWrite(name, img); !ok {
+		fmt.Println("cannot write", name)
+	}
+	s.frame++
+}
+
+func (s *pngSequenceSink) Close() error {
+	return nil
+}
+
+// MemorySink keeps shown frames in memory so they can be inspected afterwards
+type MemorySink struct {
+	// Keep is the max number of frames kept, dropping the oldest first. 0 keeps all frames
+	Keep   int
+	Frames []image.Image
+	// Shown counts all frames shown, including dropped ones
+	Shown int
+}
+
+func NewMemorySink(keep int) *MemorySink {
+	return &MemorySink{Keep: keep}
+}
+
+func (s *MemorySink) Show(img gocv.Mat) {
+	s.Shown++
+	frame, err := img.ToImage()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	s.Frames = append(s.Frames, frame)
+	if s.Keep > 0 && len(s.Frames) > s.Keep {
+		s.Frames = s.Frames[len(s.Frames)-s.Keep:]
+	}
+}
+
+// Last returns the most recently shown frame, or nil if there is none
+func (s *MemorySink) Last() image.Image {
+	if len(s.Frames) == 0 {
+		return nil
+	}
+	return s.Frames[len(s.Frames)-1]
+}
+
+func (s *MemorySink) Close() error {
+	return nil
+}
+
+// scriptedKeys ends frameloop i after stages[i] frames.
+// Once the script runs out, every further frameloop ends after 'every' frames.
+// NOTE: this never pumps HighGUI events, so pair it with non-window sinks
+type scriptedKeys struct {
+	stages []int
+	every  int
+	stage  int
+	frame  int
+}
+
+// ScriptedKeys presses a key after the given number of frames, per stage:
+// the calibration stages followed by the main vision loop.
+// Stages beyond the script end after their first frame.
+func ScriptedKeys(stages ...int) KeySource {
+	return &scriptedKeys{stages: stages}
+}
+
+// FrameCountKeys presses a key every n frames, advancing each stage after n frames
+func FrameCountKeys(n int) KeySource {
+	return &scriptedKeys{every: n}
+}
+
+func (k *scriptedKeys) WaitKey(_ int) int {
+	k.frame++
+	limit := k.every
+	if k.stage < len(k.stages) {
+		limit = k.stages[k.stage]
+	}
+	if k.frame < limit {
+		return -1
+	}
+	k.stage++
+	k.frame = 0
+	// any key will do, frameloop only checks for >= 0
+	return ' '
+}
@@ -0,0 +1,116 @@
+package talk
+
+import (
+	"image"
+	"testing"
+
+	"gocv.io/x/gocv"
+)
+
+// straightChessboard that leaves STRAIGHT_W x STRAIGHT_H frames as they are
+func identityChessboard() straightChessboard {
+	mapX := gocv.NewMatWithSize(STRAIGHT_H, STRAIGHT_W, gocv.MatTypeCV32F)
+	mapY := gocv.NewMatWithSize(STRAIGHT_H, STRAIGHT_W, gocv.MatTypeCV32F)
+	for y := 0; y < STRAIGHT_H; y++ {
+		for x := 0; x < STRAIGHT_W; x++ {
+			mapX.SetFloatAt(y, x, float32(x))
+			mapY.SetFloatAt(y, x, float32(y))
+		}
+	}
+	return straightChessboard{
+		MapX: mapX,
+		MapY: mapY,
+		Roi:  image.Rect(0, 0, STRAIGHT_W, STRAIGHT_H),
+		M:    gocv.Eye(3, 3, gocv.MatTypeCV64F),
+	}
+}
+
+// frames of a single gray level, 10 brighter each frame, until n frames are read
+func grayFrames(n int) FrameSource {
+	return GeneratorSource(func(frame int, img *gocv.Mat) bool {
+		if frame == n {
+			return false
+		}
+		gray := float64(10 * (frame + 1))
+		m := gocv.NewMatWithSizeFromScalar(gocv.NewScalar(gray, gray, gray, 0), STRAIGHT_H, STRAIGHT_W, gocv.MatTypeCV8UC3)
+		defer m.Close()
+		m.CopyTo(img)
+		return true
+	})
+}
+
+func TestMemorySinkKeepsFramesOfHeadlessRun(t *testing.T) {
+	lockstep = true
+	defer func() { lockstep = false }()
+
+	sc := identityChessboard()
+	defer sc.MapX.Close()
+	defer sc.MapY.Close()
+	defer sc.M.Close()
+	img := gocv.NewMat()
+	defer img.Close()
+	cimg := gocv.NewMatWithSizeFromScalar(gocv.NewScalar(0, 0, 255, 0), beamerHeight, beamerWidth, gocv.MatTypeCV8UC3)
+	defer cimg.Close()
+
+	debug, projector := NewMemorySink(2), NewMemorySink(0)
+	fi := frameInput{
+		webcam:      grayFrames(5),
+		debugWindow: debug,
+		projection:  projector,
+		keys:        ScriptedKeys(3),
+		img:         img,
+		cimg:        cimg,
+		scChsBrd:    sc,
+	}
+	evaluated := 0
+	key, err := frameloop(fi, func(gocv.Mat, gocv.Mat, image.Image, partition) { evaluated++ }, nil, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key < 0 {
+		t.Fatalf("got key %d, want the scripted keypress", key)
+	}
+	if evaluated != 3 || debug.Shown != 3 || projector.Shown != 3 {
+		t.Fatalf("evaluated %d, shown %d debug and %d projector frames, want 3 each", evaluated, debug.Shown, projector.Shown)
+	}
+	if len(debug.Frames) != 2 || len(projector.Frames) != 3 {
+		t.Fatalf("kept %d debug and %d projector frames, want 2 and 3", len(debug.Frames), len(projector.Frames))
+	}
+
+	// in lockstep nothing is dropped: the debug sink kept the straightened frames 2 and 3
+	mid := image.Pt(STRAIGHT_W/2, STRAIGHT_H/2)
+	for i, want := range []uint8{20, 30} {
+		f := debug.Frames[i]
+		if f.Bounds().Dx() != STRAIGHT_W || f.Bounds().Dy() != STRAIGHT_H {
+			t.Fatalf("debug frame %d is %v, want %dx%d", i, f.Bounds(), STRAIGHT_W, STRAIGHT_H)
+		}
+		r, g, b, _ := f.At(mid.X, mid.Y).RGBA()
+		if uint8(r>>8) != want || uint8(g>>8) != want || uint8(b>>8) != want {
+			t.Errorf("debug frame %d has gray %d %d %d, want %d", i, r>>8, g>>8, b>>8, want)
+		}
+	}
+	r, g, b, _ := projector.Last().At(beamerWidth/2, beamerHeight/2).RGBA()
+	if r>>8 != 255 || g>>8 != 0 || b>>8 != 0 {
+		t.Errorf("projector frame is %d %d %d, want the red canvas", r>>8, g>>8, b>>8)
+	}
+}
+
+func TestScriptedKeys(t *testing.T) {
+	keys := ScriptedKeys(2, 1)
+	var pressed []int
+	for i := 0; i < 5; i++ {
+		if keys.WaitKey(1) >= 0 {
+			pressed = append(pressed, i)
+		}
+	}
+	// after 2 frames, after 1 more, then every frame once the script runs out
+	want := []int{1, 2, 3, 4}
+	if len(pressed) != len(want) {
+		t.Fatalf("pressed after %v, want %v", pressed, want)
+	}
+	for i := range want {
+		if pressed[i] != want[i] {
+			t.Fatalf("pressed after %v, want %v", pressed, want)
+		}
+	}
+}
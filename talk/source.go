@@ -0,0 +1,117 @@
+package talk
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gocv.io/x/gocv"
+)
+
+// FrameSource is anything the vision pipeline can read camera frames from.
+// Read returns false once no more frames can be read, which ends the frameloop.
+// *gocv.VideoCapture satisfies this interface as is.
+type FrameSource interface {
+	Read(*gocv.Mat) bool
+	Close() error
+}
+
+var frameSource FrameSource
+
+// UseFrameSource makes Run read frames from src instead of the default webcam
+func UseFrameSource(src FrameSource) {
+	frameSource = src
+}
+
+// DeviceSource opens a live capture device by index, i.e. a webcam
+func DeviceSource(index int) (FrameSource, error) {
+	webcam, err := gocv.VideoCaptureDevice(index)
+	if err != nil {
+		return nil, err
+	}
+	return webcam, nil
+}
+
+// VideoFileSource reads frames from a recorded video file
+func VideoFileSource(path string) (FrameSource, error) {
+	video, err := gocv.VideoCaptureFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return video, nil
+}
+
+// imageDirSource reads all png files in a directory in lexical order.
+// Frames are expected to be named so that this matches recording order,
+// e.g. frame00001.png, frame00002.png, ...
+type imageDirSource struct {
+	files []string
+	next  int
+	loop  bool
+}
+
+// ImageDirSource reads a directory of png frames, one per Read.
+// If loop is set, it starts over from the first frame after the last one.
+func ImageDirSource(dir string, loop bool) (FrameSource, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	files := []string{}
+	for _, e := range entries {
+		if e.IsDir() || !strings.EqualFold(filepath.Ext(e.Name()), ".png") {
+			continue
+		}
+		files = append(files, filepath.Join(dir, e.Name()))
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no png frames found in %s", dir)
+	}
+	sort.Strings(files)
+	return &imageDirSource{files: files, loop: loop}, nil
+}
+
+func (s *imageDirSource) Read(img *gocv.Mat) bool {
+	if s.next == len(s.files) {
+		if !s.loop {
+			return false
+		}
+		s.next = 0
+	}
+	frame := gocv.IMRead(s.files[s.next], gocv.IMReadColor)
+	defer frame.Close()
+	s.next++
+	if frame.Empty() {
+		return false
+	}
+	frame.CopyTo(img)
+	return true
+}
+
+func (s *imageDirSource) Close() error {
+	return nil
+}
+
+// generatorSource produces frames in memory, for synthetic scenes
+type generatorSource struct {
+	f     func(frame int, img *gocv.Mat) bool
+	frame int
+}
+
+// GeneratorSource calls f for each frame with the frame number and the Mat to draw into.
+// f returns false to signal there are no more frames.
+func GeneratorSource(f func(frame int, img *gocv.Mat) bool) FrameSource {
+	return &generatorSource{f: f}
+}
+
+func (s *generatorSource) Read(img *gocv.Mat) bool {
+	ok := s.f(s.frame, img)
+	s.frame++
+	return ok
+}
+
+func (s *generatorSource) Close() error {
+	return nil
+}
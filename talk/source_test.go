@@ -0,0 +1,95 @@
+package talk
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gocv.io/x/gocv"
+)
+
+// writeGrayPNG writes a small png filled with gray level v
+func writeGrayPNG(t *testing.T, path string, v uint8) {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, 4, 3))
+	for y := 0; y < 3; y++ {
+		for x := 0; x < 4; x++ {
+			img.Set(x, y, color.RGBA{v, v, v, 255})
+		}
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := png.Encode(f, img); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// framesDir has frames 1 to 3 written out of order, gray level 10 times their number, and a file that is no frame
+func framesDir(t *testing.T) string {
+	dir := t.TempDir()
+	for _, n := range []int{3, 1, 2} {
+		writeGrayPNG(t, filepath.Join(dir, fmt.Sprintf("frame%05d.png", n)), uint8(10*n))
+	}
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("not a frame"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// readLevels reads n frames from src, returning the gray level of each and whether Read succeeded
+func readLevels(src FrameSource, n int) ([]uint8, []bool) {
+	img := gocv.NewMat()
+	defer img.Close()
+	levels, oks := make([]uint8, n), make([]bool, n)
+	for i := range levels {
+		oks[i] = src.Read(&img)
+		if oks[i] {
+			levels[i] = img.GetUCharAt(0, 0)
+		}
+	}
+	return levels, oks
+}
+
+func TestImageDirSourceReadsInOrder(t *testing.T) {
+	src, err := ImageDirSource(framesDir(t), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	levels, oks := readLevels(src, 4)
+	for i, want := range []uint8{10, 20, 30} {
+		if !oks[i] || levels[i] != want {
+			t.Errorf("frame %d: read %v with level %d, want level %d", i, oks[i], levels[i], want)
+		}
+	}
+	if oks[3] {
+		t.Errorf("read a frame past the last one")
+	}
+}
+
+func TestImageDirSourceLoops(t *testing.T) {
+	src, err := ImageDirSource(framesDir(t), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	levels, oks := readLevels(src, 5)
+	for i, want := range []uint8{10, 20, 30, 10, 20} {
+		if !oks[i] || levels[i] != want {
+			t.Errorf("frame %d: read %v with level %d, want level %d", i, oks[i], levels[i], want)
+		}
+	}
+}
+
+func TestImageDirSourceWithoutFrames(t *testing.T) {
+	if _, err := ImageDirSource(t.TempDir(), false); err == nil {
+		t.Errorf("no error for a directory without png files")
+	}
+}
@@ -3,7 +3,7 @@
  but a wish is a special kind of assertion to be used in 'when'
  example: when /someone/ wishes x: <code>
  after running fixpoint analysis once per frame, some claims are still picked up
- outside of db and executed upon, mostly illumination-related (blit)
+ outside of db and executed upon, mostly illumination-related (compositing)
  TODO: insertion of var 'this' does not work properly? execution context is not correct
  solution: insert (define this ?id) at start of each codeblock? |#
 (define-syntax claim
@@ -43,3 +43,26 @@
     (map dl_update_indices new)
     (map (lambda (c) (eval (car (cdr (cdr c))))) new)
     (if (not (null? new)) (dl_fixpoint_iterate)))))
+
+#| maps a point in page space, (x . y) in cm on the sheet from its upper left, to projector space
+ using the homography of a page as stored in its 'homography: three rows of three numbers |#
+(define page->projector (lambda (h p)
+  (let ((x (car p))
+        (y (cdr p))
+        (r0 (car h))
+        (r1 (car (cdr h)))
+        (r2 (car (cdr (cdr h)))))
+    (let ((w (+ (+ (* (car r2) x) (* (car (cdr r2)) y)) (car (cdr (cdr r2))))))
+      (cons
+        (/ (+ (+ (* (car r0) x) (* (car (cdr r0)) y)) (car (cdr (cdr r0)))) w)
+        (/ (+ (+ (* (car r1) x) (* (car (cdr r1)) y)) (car (cdr (cdr r1)))) w))))))
+
+#| same as page->projector, to straightened camera space with the 'camera-homography of a page |#
+(define page->camera page->projector)
+
+#| page canvases are drawn upright in page space: these take cm on the sheet to canvas pixels |#
+(define canvas-point (lambda (x y)
+  (point2d (* x canvasPixelsPerCM) (* y canvasPixelsPerCM))))
+
+(define canvas-rect (lambda (minx miny maxx maxy)
+  (make-rectangle (* minx canvasPixelsPerCM) (* miny canvasPixelsPerCM) (* maxx canvasPixelsPerCM) (* maxy canvasPixelsPerCM))))
@@ -0,0 +1,322 @@
+package talk
+
+import (
+	"math"
+	"sort"
+)
+
+// trackState is how sure we are a page is where we think it is
+type trackState int
+
+const (
+	// seen in at least TrackerConfig.ConfirmFrames frames in a row
+	trackVisible trackState = iota
+	// missing for now: its position is predicted from how it moved before
+	trackPredicted
+	// missing for longer than TrackerConfig.LostFrames, or missed before it was confirmed
+	trackLost
+	// new, and not seen in ConfirmFrames frames in a row yet
+	trackTentative
+)
+
+func (s trackState) String() string {
+	switch s {
+	case trackVisible:
+		return "visible"
+	case trackPredicted:
+		return "predicted"
+	case trackTentative:
+		return "tentative"
+	}
+	return "lost"
+}
+
+// shown is whether pages in this state are evaluated
+func (s trackState) shown() bool {
+	return s == trackVisible || s == trackPredicted
+}
+
+// TrackerConfig tunes how pages are tracked across frames
+type TrackerConfig struct {
+	// gains of the alpha-beta filters on position and velocity, in (0,1].
+	// Lower smooths out more jitter but lags behind a moving page
+	Alpha, Beta float64
+	// consecutive frames a page must be seen before it is visible.
+	// Above 1, a page put down only shows up that many frames later minus one:
+	// never, when there are fewer frames than that, like a single png
+	ConfirmFrames int
+	// frames a visible page can go missing, with its position predicted, before it is lost
+	LostFrames int
+	// frames a page can go missing before we forget about it. A copy put back before then
+	// keeps its instance, after that it is a new one. Should be more than LostFrames
+	ExpireFrames int
+	// max distance in cm between where we predict a corner and where one is detected
+	// to correct the colours of the detected one
+	MatchCM float64
+	// max distance in cm between where we predict a copy of a page and where one is recognised
+	// for them to be the same copy
+	InstanceCM float64
+}
+
+var DefaultTrackerConfig = TrackerConfig{
+	Alpha:         0.6,
+	Beta:          0.2,
+	ConfirmFrames: 1,
+	LostFrames:    10,
+	ExpireFrames:  100,
+	MatchCM:       3.0,
+	InstanceCM:    10.0,
+}
+
+var trackerConfig = DefaultTrackerConfig
+
+// UseTrackerConfig replaces the settings used to track pages across frames
+func UseTrackerConfig(c TrackerConfig) {
+	trackerConfig = c
+}
+
+// alphaBeta filters one coordinate, with its velocity in units per frame
+type alphaBeta struct {
+	x, v float64
+}
+
+func (f *alphaBeta) predict() {
+	f.x += f.v
+}
+
+func (f *alphaBeta) correct(measured, alpha, beta float64) {
+	r := measured - f.x
+	f.x += alpha * r
+	f.v += beta * r
+}
+
+// pageTrack follows one page: the m points of its corners and its angle are filtered,
+// the other dots of each corner move along with their m
+type pageTrack struct {
+	// as last recognised
+	page page
+	// x and y of m for ulhc, urhc, lrhc, llhc
+	corners [4][2]alphaBeta
+	// unwrapped, so it can be filtered across 2pi
+	angle  alphaBeta
+	hits   int
+	misses int
+	state  trackState
+}
+
+func newPageTrack(p page) *pageTrack {
+	t := &pageTrack{state: trackTentative}
+	t.reset(p)
+	return t
+}
+
+func (t *pageTrack) reset(p page) {
+	t.page = p
+	for i, c := range pageCorners(p) {
+		t.corners[i] = [2]alphaBeta{{x: c.m.p.x}, {x: c.m.p.y}}
+	}
+	t.angle = alphaBeta{x: p.angle}
+	t.hits, t.misses = 0, 0
+}
+
+func (t *pageTrack) predict() {
+	for i := range t.corners {
+		t.corners[i][0].predict()
+		t.corners[i][1].predict()
+	}
+	t.angle.predict()
+}
+
+func (t *pageTrack) correct(p page, cfg TrackerConfig) {
+	t.page = p
+	for i, c := range pageCorners(p) {
+		t.corners[i][0].correct(c.m.p.x, cfg.Alpha, cfg.Beta)
+		t.corners[i][1].correct(c.m.p.y, cfg.Alpha, cfg.Beta)
+	}
+	// measure the angle in the same turn as our estimate
+	a := p.angle + 2*math.Pi*math.Round((t.angle.x-p.angle)/(2*math.Pi))
+	t.angle.correct(a, cfg.Alpha, cfg.Beta)
+}
+
+// estimate is the page at its filtered position
+func (t *pageTrack) estimate() page {
+	return t.at(func(f alphaBeta) float64 { return f.x }, t.angle.x)
+}
+
+// predicted is where we expect the page in the next frame
+func (t *pageTrack) predicted() page {
+	return t.at(func(f alphaBeta) float64 { return f.x + f.v }, t.angle.x+t.angle.v)
+}
+
+func (t *pageTrack) at(pos func(alphaBeta) float64, angle float64) page {
+	p := t.page
+	cs := pageCorners(p)
+	for i, c := range cs {
+		delta := point{pos(t.corners[i][0]), pos(t.corners[i][1])}.sub(c.m.p)
+		cs[i] = corner{
+			ll: dot{p: c.ll.p.add(delta), c: c.ll.c, conf: c.ll.conf},
+			l:  dot{p: c.l.p.add(delta), c: c.l.c, conf: c.l.conf},
+			m:  dot{p: c.m.p.add(delta), c: c.m.c, conf: c.m.conf},
+			r:  dot{p: c.r.p.add(delta), c: c.r.c, conf: c.r.conf},
+			rr: dot{p: c.rr.p.add(delta), c: c.rr.c, conf: c.rr.conf},
+		}
+	}
+	p.ulhc, p.urhc, p.lrhc, p.llhc = cs[0], cs[1], cs[2], cs[3]
+	p.angle = math.Mod(angle, 2*math.Pi)
+	if p.angle < 0 {
+		p.angle += 2 * math.Pi
+	}
+	return p
+}
+
+func pageCorners(p page) [4]corner {
+	return [4]corner{p.ulhc, p.urhc, p.lrhc, p.llhc}
+}
+
+// pageTracker keeps a track per instance: a physical copy of a page, as there can be several.
+// A new instance has to be seen ConfirmFrames in a row to become visible, and a visible one has to be
+// missing LostFrames in a row to be lost: this hysteresis keeps flaky detection from making pages flicker in and out.
+// Tracks missing for more than ExpireFrames are dropped
+type pageTracker struct {
+	tracks map[uint64]*pageTrack
+	// instance ids are never reused, so they can tell copies apart across frames
+	nextInstance uint64
+	// in straightened space
+	pixelsPerCM float64
+}
+
+type trackedPage struct {
+	page  page
+	state trackState
+}
+
+func newPageTracker(pixelsPerCM float64) *pageTracker {
+	return &pageTracker{tracks: map[uint64]*pageTrack{}, pixelsPerCM: pixelsPerCM}
+}
+
+// update advances all tracks a frame, given the pages recognised in it.
+// Each recognised page is matched to the nearest track of a copy of the same page, or starts a new one.
+// It returns all tracked pages, sorted by id and then instance
+func (pt *pageTracker) update(pages []page) []trackedPage {
+	cfg := trackerConfig
+	seen := map[uint64]bool{}
+	for _, p := range pt.matchInstances(pages) {
+		seen[p.instance] = true
+		t, ok := pt.tracks[p.instance]
+		if !ok {
+			t = newPageTrack(p)
+			pt.tracks[p.instance] = t
+		} else if t.state == trackLost && t.misses > 0 {
+			// whatever we knew about its motion is stale, and it has to be confirmed again
+			t.reset(p)
+			t.state = trackTentative
+		} else {
+			t.predict()
+			t.correct(p, cfg)
+		}
+		t.hits++
+		t.misses = 0
+		if t.hits >= cfg.ConfirmFrames {
+			t.state = trackVisible
+		}
+	}
+	for instance, t := range pt.tracks {
+		if seen[instance] {
+			continue
+		}
+		t.hits = 0
+		t.misses++
+		switch {
+		case t.state == trackLost:
+		case t.state == trackTentative || t.misses > cfg.LostFrames:
+			t.state = trackLost
+		default:
+			t.predict()
+			t.state = trackPredicted
+		}
+		if t.state == trackLost && t.misses > cfg.ExpireFrames {
+			delete(pt.tracks, instance)
+		}
+	}
+
+	out := make([]trackedPage, 0, len(pt.tracks))
+	for _, t := range pt.tracks {
+		out = append(out, trackedPage{page: t.estimate(), state: t.state})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].page.id != out[j].page.id {
+			return out[i].page.id < out[j].page.id
+		}
+		return out[i].page.instance < out[j].page.instance
+	})
+	return out
+}
+
+// matchInstances returns pages with their instance set: closest pairs of a page and a track
+// of the same page are matched first, pages too far from any unmatched track get a new instance
+func (pt *pageTracker) matchInstances(pages []page) []page {
+	type pair struct {
+		page     int
+		instance uint64
+		dist     float64
+	}
+	pairs := []pair{}
+	for i, p := range pages {
+		for instance, t := range pt.tracks {
+			if t.page.id != p.id {
+				continue
+			}
+			d := euclidian(pageCenter(t.predicted()).sub(pageCenter(p)))
+			if pt.pixelsPerCM > 0 && d > trackerConfig.InstanceCM*pt.pixelsPerCM {
+				continue
+			}
+			pairs = append(pairs, pair{page: i, instance: instance, dist: d})
+		}
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i].dist != pairs[j].dist {
+			return pairs[i].dist < pairs[j].dist
+		}
+		return pairs[i].instance < pairs[j].instance
+	})
+	out := make([]page, len(pages))
+	copy(out, pages)
+	matched := map[int]bool{}
+	taken := map[uint64]bool{}
+	for _, m := range pairs {
+		if matched[m.page] || taken[m.instance] {
+			continue
+		}
+		out[m.page].instance = m.instance
+		matched[m.page], taken[m.instance] = true, true
+	}
+	for i := range out {
+		if !matched[i] {
+			pt.nextInstance++
+			out[i].instance = pt.nextInstance
+		}
+	}
+	return out
+}
+
+// pageCenter is the mean of the corner tops of p
+func pageCenter(p page) point {
+	center := point{}
+	for _, c := range pageCorners(p) {
+		center = center.add(c.m.p)
+	}
+	return center.div(4)
+}
+
+// expectedCorners are the corners of visible and predicted pages marked with f, where we expect them this frame
+func (pt *pageTracker) expectedCorners(f fiducial) []corner {
+	cs := []corner{}
+	for _, t := range pt.tracks {
+		if !t.state.shown() || t.page.fiducial != f {
+			continue
+		}
+		p := t.predicted()
+		cs = append(cs, p.ulhc, p.urhc, p.lrhc, p.llhc)
+	}
+	return cs
+}
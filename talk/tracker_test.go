@@ -0,0 +1,140 @@
+package talk
+
+import (
+	"math"
+	"testing"
+)
+
+// testPage is page id with its corner tops at the corners of a w by h rectangle from (x, y), upright
+func testPage(id uint64, x, y, w, h float64) page {
+	arm := 40.
+	return page{
+		id:   id,
+		ulhc: testCorner(point{x, y}, 0, arm),
+		urhc: testCorner(point{x + w, y}, math.Pi/2, arm),
+		lrhc: testCorner(point{x + w, y + h}, math.Pi, arm),
+		llhc: testCorner(point{x, y + h}, 3*math.Pi/2, arm),
+	}
+}
+
+func useTrackerConfig(t *testing.T, c TrackerConfig) {
+	old := trackerConfig
+	trackerConfig = c
+	t.Cleanup(func() { trackerConfig = old })
+}
+
+func TestAlphaBetaFollowsConstantVelocity(t *testing.T) {
+	f := alphaBeta{}
+	for k := 1; k <= 50; k++ {
+		f.predict()
+		f.correct(2*float64(k), 0.6, 0.2)
+	}
+	if math.Abs(f.v-2) > 0.01 || math.Abs(f.x-100) > 0.1 {
+		t.Errorf("got x %.3f v %.3f, want 100 and 2", f.x, f.v)
+	}
+}
+
+func TestAlphaBetaSmoothsJitter(t *testing.T) {
+	f := alphaBeta{x: 10}
+	for k := 0; k < 50; k++ {
+		f.predict()
+		// a page lying still, detected a pixel off either way
+		f.correct(10+float64(2*(k%2)-1), 0.6, 0.2)
+		if k > 10 && math.Abs(f.x-10) >= 1 {
+			t.Fatalf("frame %d: estimate %.3f jitters as much as the measurements", k, f.x)
+		}
+	}
+}
+
+func TestTrackerHysteresis(t *testing.T) {
+	useTrackerConfig(t, TrackerConfig{Alpha: 0.6, Beta: 0.2, ConfirmFrames: 2, LostFrames: 3, ExpireFrames: 10, InstanceCM: 10})
+	tracker := newPageTracker(10)
+	p := testPage(1, 100, 100, 200, 150)
+	none := []page{}
+
+	for i, tt := range []struct {
+		pages []page
+		want  trackState
+	}{
+		{[]page{p}, trackTentative},
+		{[]page{p}, trackVisible},
+		{none, trackPredicted},
+		{none, trackPredicted},
+		{none, trackPredicted},
+		{none, trackLost},
+		// back after being lost: confirmed again from scratch
+		{[]page{p}, trackTentative},
+		{none, trackLost},
+		{[]page{p}, trackTentative},
+		{[]page{p}, trackVisible},
+	} {
+		got := tracker.update(tt.pages)
+		if len(got) != 1 {
+			t.Fatalf("frame %d: tracking %d pages, want 1", i, len(got))
+		}
+		if got[0].state != tt.want {
+			t.Errorf("frame %d: state %v, want %v", i, got[0].state, tt.want)
+		}
+	}
+}
+
+func TestTrackerShowsNewPageRightAway(t *testing.T) {
+	useTrackerConfig(t, DefaultTrackerConfig)
+	tracker := newPageTracker(10)
+	got := tracker.update([]page{testPage(1, 100, 100, 200, 150)})
+	if len(got) != 1 || !got[0].state.shown() {
+		t.Fatalf("got %v, want the page shown on the first frame it is seen", got)
+	}
+}
+
+func TestTrackerPredictsMissingPage(t *testing.T) {
+	useTrackerConfig(t, TrackerConfig{Alpha: 0.6, Beta: 0.2, ConfirmFrames: 1, LostFrames: 5, ExpireFrames: 10, InstanceCM: 10})
+	tracker := newPageTracker(10)
+	// moving right 5 pixels a frame
+	for k := 0; k < 30; k++ {
+		tracker.update([]page{testPage(1, 100+5*float64(k), 100, 200, 150)})
+	}
+	got := tracker.update(nil)
+	want := 100 + 5*30.
+	if x := got[0].page.ulhc.m.p.x; got[0].state != trackPredicted || math.Abs(x-want) > 0.5 {
+		t.Errorf("got %v at x %.2f, want predicted at %.0f", got[0].state, x, want)
+	}
+}
+
+func TestTrackerReusesInstanceUntilExpired(t *testing.T) {
+	useTrackerConfig(t, TrackerConfig{Alpha: 0.6, Beta: 0.2, ConfirmFrames: 1, LostFrames: 2, ExpireFrames: 5, InstanceCM: 10})
+	tracker := newPageTracker(10)
+	p := testPage(1, 100, 100, 200, 150)
+
+	first := tracker.update([]page{p})[0].page.instance
+	for k := 0; k < 5; k++ {
+		tracker.update(nil)
+	}
+	got := tracker.update([]page{p})
+	if len(got) != 1 || got[0].page.instance != first {
+		t.Fatalf("put back before expiring: got %v, want instance %d again", got, first)
+	}
+
+	for k := 0; k < 5; k++ {
+		tracker.update(nil)
+	}
+	if got := tracker.update(nil); len(got) != 0 || len(tracker.tracks) != 0 {
+		t.Fatalf("missing for longer than ExpireFrames: still tracking %v", got)
+	}
+	got = tracker.update([]page{p})
+	if len(got) != 1 || got[0].page.instance == first {
+		t.Errorf("put back after expiring: got %v, want a new instance", got)
+	}
+}
+
+func TestTrackerForgetsPagesThatCameAndWent(t *testing.T) {
+	useTrackerConfig(t, DefaultTrackerConfig)
+	tracker := newPageTracker(10)
+	// a different copy each frame, like a page moving too fast to match
+	for k := 0; k < 1000; k++ {
+		tracker.update([]page{testPage(1, float64(1000*k), 100, 200, 150)})
+	}
+	if n := len(tracker.tracks); n > DefaultTrackerConfig.ExpireFrames+2 {
+		t.Errorf("tracking %d pages, want no more than were seen in the last %d frames", n, DefaultTrackerConfig.ExpireFrames)
+	}
+}
@@ -0,0 +1,92 @@
+package talk
+
+import "math"
+
+// With two corner ids we recognise a page from just two of its corners, see UseTwoCornerIDs.
+// The other two are where the printed page says they should be: the sides of a page are
+// as long as the distances between its corner tops, and at right angles.
+// Distances on the page we only know relative to the ones we see, so this works at any scale
+
+// max difference in radians between the angles of the arms of seen corners and what the page geometry says
+const twoCornerAngleTolerance = 0.1
+
+// max difference between a diagonal as seen and as printed, as a fraction of the printed one
+const twoCornerDistTolerance = 0.15
+
+// sideCM is the length of the side of a page from corner top k to the next one clockwise
+func sideCM(k int) float64 {
+	return euclidian(cornerTopsCM[(k+1)%4].sub(cornerTopsCM[k%4]))
+}
+
+// diagonalCM is the distance between opposite corner tops
+func diagonalCM() float64 {
+	return euclidian(cornerTopsCM[2].sub(cornerTopsCM[0]))
+}
+
+// diagonalAngle is the angle between the right arm of corner k and the diagonal to the opposite corner
+func diagonalAngle(k int) float64 {
+	return math.Atan(sideCM(k+1) / sideCM(k))
+}
+
+// cornerAt makes a corner at m with arms of length armLen pointing at its neighbours, with unknown colours
+func cornerAt(m, prev, next point, armLen float64) corner {
+	arm := func(towards point, f float64) dot {
+		d := towards.sub(m)
+		return dot{p: m.add(d.mul(f * armLen / euclidian(d))), c: unknownDot}
+	}
+	return corner{ll: arm(prev, 1), l: arm(prev, .5), m: dot{p: m, c: unknownDot}, r: arm(next, .5), rr: arm(next, 1)}
+}
+
+// completeAdjacent returns all corners of a page, clockwise from c, seen from corner k c and the next one clockwise.
+// The other two lie in the direction of the left arm of c and the right arm of next
+func completeAdjacent(c, next corner, k int) []corner {
+	side := next.m.p.sub(c.m.p)
+	along := unit(side)
+	dir := unit(c.ll.p.sub(c.m.p)).add(unit(next.rr.p.sub(next.m.p)))
+	// sides of a page are at right angles, whatever the arms say
+	dir = dir.sub(along.mul(dir.dot(along)))
+	if euclidian(dir) == 0 {
+		return nil
+	}
+	dir = unit(dir).mul(euclidian(side) * sideCM(k+1) / sideCM(k))
+	prevM, farM := c.m.p.add(dir), next.m.p.add(dir)
+	armLen := euclidian(c.rr.p.sub(c.m.p))
+	return []corner{c, next, cornerAt(farM, next.m.p, prevM, armLen), cornerAt(prevM, farM, c.m.p, armLen)}
+}
+
+// completeDiagonal returns all corners of a page, clockwise from c, seen from corner k c and the one opposite it, o.
+// The next corner clockwise from c lies along its right arm, at the angle the page geometry says
+func completeDiagonal(c, o corner, k int) []corner {
+	diag := o.m.p.sub(c.m.p)
+	right := c.rr.p.sub(c.m.p)
+	theta := diagonalAngle(k)
+	// rotating the diagonal one way or the other lines it up with the right arm
+	side := rotateAround(point{}, diag, theta)
+	if other := rotateAround(point{}, diag, -theta); angleBetween(other, right) < angleBetween(side, right) {
+		side = other
+	}
+	nextM := c.m.p.add(side.mul(math.Cos(theta)))
+	prevM := c.m.p.add(o.m.p.sub(nextM))
+	armLen := euclidian(right)
+	return []corner{c, cornerAt(nextM, c.m.p, o.m.p, armLen), o, cornerAt(prevM, o.m.p, c.m.p, armLen)}
+}
+
+// diagonalPair reports whether o could be the corner opposite c on a page, with c being an even or odd corner,
+// judging by the angles of their arms to the diagonal between them and its length
+func diagonalPair(c, o corner, pixelsPerCM float64) (even, odd bool) {
+	diag := o.m.p.sub(c.m.p)
+	if pixelsPerCM > 0 && math.Abs(euclidian(diag)-diagonalCM()*pixelsPerCM) > twoCornerDistTolerance*diagonalCM()*pixelsPerCM {
+		return false, false
+	}
+	fits := func(x corner, d point, k int) bool {
+		theta := diagonalAngle(k)
+		right, left := angleBetween(x.rr.p.sub(x.m.p), d), angleBetween(x.ll.p.sub(x.m.p), d)
+		return math.Abs(right-theta) < twoCornerAngleTolerance && math.Abs(left-(math.Pi/2-theta)) < twoCornerAngleTolerance
+	}
+	back := c.m.p.sub(o.m.p)
+	return fits(c, diag, 0) && fits(o, back, 2), fits(c, diag, 1) && fits(o, back, 3)
+}
+
+func unit(p point) point {
+	return p.div(euclidian(p))
+}
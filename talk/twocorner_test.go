@@ -0,0 +1,123 @@
+package talk
+
+import (
+	"math"
+	"testing"
+)
+
+// printedCorners are the corners of a page seen rotated by angle and scaled to pixelsPerCM, clockwise from ulhc
+func printedCorners(origin point, angle, pixelsPerCM float64) []corner {
+	tops := make([]point, 4)
+	for k, p := range cornerTopsCM {
+		tops[k] = origin.add(rotateAround(point{}, p.mul(pixelsPerCM), angle))
+	}
+	cs := make([]corner, 4)
+	for k := range cs {
+		cs[k] = cornerAt(tops[k], tops[(k+3)%4], tops[(k+1)%4], 5*pixelsPerCM)
+	}
+	return cs
+}
+
+func sameTops(t *testing.T, got, want []corner, tolerance float64) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %d corners, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if d := euclidian(got[i].m.p.sub(want[i].m.p)); d > tolerance {
+			t.Errorf("corner %d at %v, want %v", i, got[i].m.p, want[i].m.p)
+		}
+	}
+}
+
+var twoCornerPoses = []struct {
+	angle, pixelsPerCM float64
+}{{0, 3}, {0.4, 3}, {math.Pi / 2, 7.5}, {2.5, 5}, {-1, 10}}
+
+func TestCompleteAdjacent(t *testing.T) {
+	for _, pose := range twoCornerPoses {
+		cs := printedCorners(point{300, 200}, pose.angle, pose.pixelsPerCM)
+		for k := 0; k < 4; k++ {
+			want := []corner{cs[k], cs[(k+1)%4], cs[(k+2)%4], cs[(k+3)%4]}
+			sameTops(t, completeAdjacent(cs[k], cs[(k+1)%4], k), want, 1e-6)
+		}
+	}
+}
+
+func TestCompleteDiagonal(t *testing.T) {
+	for _, pose := range twoCornerPoses {
+		cs := printedCorners(point{300, 200}, pose.angle, pose.pixelsPerCM)
+		for k := 0; k < 4; k++ {
+			want := []corner{cs[k], cs[(k+1)%4], cs[(k+2)%4], cs[(k+3)%4]}
+			sameTops(t, completeDiagonal(cs[k], cs[(k+2)%4], k), want, 1e-6)
+		}
+	}
+}
+
+func TestDiagonalPair(t *testing.T) {
+	for _, pose := range twoCornerPoses {
+		cs := printedCorners(point{300, 200}, pose.angle, pose.pixelsPerCM)
+		for k := 0; k < 4; k++ {
+			even, odd := diagonalPair(cs[k], cs[(k+2)%4], pose.pixelsPerCM)
+			if even != (k%2 == 0) || odd != (k%2 == 1) {
+				t.Errorf("angle %.2f, corner %d: got even %v odd %v", pose.angle, k, even, odd)
+			}
+			// seen at twice the size we expect, it cant be a diagonal of the same page
+			if even, odd := diagonalPair(cs[k], cs[(k+2)%4], pose.pixelsPerCM/2); even || odd {
+				t.Errorf("angle %.2f, corner %d: diagonal twice as long as printed still fits", pose.angle, k)
+			}
+			// adjacent corners are never a diagonal pair
+			if even, odd := diagonalPair(cs[k], cs[(k+1)%4], 0); even || odd {
+				t.Errorf("angle %.2f, corner %d: adjacent corners fit as a diagonal", pose.angle, k)
+			}
+		}
+	}
+}
+
+func TestUseTwoCornerIDsChecksPagesAdded(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		pages [][4]string
+		ok    bool
+	}{
+		{name: "no pages", ok: true},
+		{
+			name:  "pages told apart by two corners",
+			pages: [][4]string{{"rgbyr", "ggbyg", "ybrgb", "rrrry"}, {"yyyyy", "bgrgb", "rbgyy", "gyrbg"}},
+			ok:    true,
+		},
+		{
+			name:  "pages sharing two adjacent corners",
+			pages: [][4]string{{"rgbyr", "ggbyg", "ybrgb", "rrrry"}, {"rgbyr", "ggbyg", "rbgyy", "gyrbg"}},
+			ok:    false,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			useIDs(t, fullIDScheme)
+			for _, p := range tt.pages {
+				if !AddPageFromShorthand(p[0], p[1], p[2], p[3], "") {
+					t.Fatalf("page %v not registered", p)
+				}
+			}
+			err := UseTwoCornerIDs()
+			if (err == nil) != tt.ok {
+				t.Fatalf("got error %v, want ok %v", err, tt.ok)
+			}
+			if twoCornerIDs != tt.ok {
+				t.Errorf("using two corner ids: %v, want %v", twoCornerIDs, tt.ok)
+			}
+			if !tt.ok {
+				return
+			}
+			if len(adjacentDB) != 4*len(tt.pages) || len(diagonalDB) != 4*len(tt.pages) {
+				t.Errorf("got %d adjacent and %d diagonal views, want %d of each", len(adjacentDB), len(diagonalDB), 4*len(tt.pages))
+			}
+			for _, p := range tt.pages {
+				cs := []corner{cornerShorthand(p[1]), cornerShorthand(p[2])}
+				if v, ok := lookupView(adjacentDB, cs); !ok || v.first != 1 {
+					t.Errorf("page %v not found from its urhc and lrhc", p)
+				}
+			}
+		})
+	}
+}